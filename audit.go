@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Actor is the authenticated principal that made the change, ClaimedActor the unverified name the
+// client sent in X-Actor, kept for reference only
+type AuditEntry struct {
+	Actor           string    `json:"actor"`
+	ClaimedActor    string    `json:"claimedActor,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+	RequestID       string    `json:"requestId"`
+	PreviousVersion int       `json:"previousVersion"`
+	Version         int       `json:"version"`
+	Diff            RateDiff  `json:"diff"`
+}
+
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Offset  int          `json:"offset"`
+	Limit   int          `json:"limit"`
+}
+
+// Append only JSONL log of rate changes. Every entry is synced to disk before Append returns.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func NewAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{
+		path: path,
+		file: file,
+	}, nil
+}
+
+func (a *AuditLog) Append(entry AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// Returned along with a change that was applied but could not be written to the audit log
+var errAuditWrite = errors.New("rates changed but the audit log write failed")
+
+// Who made a change, see AuditEntry
+type auditActor struct {
+	Actor        string
+	ClaimedActor string
+	RequestID    string
+}
+
+// Appends a committed change. A nil log records nothing so auditing stays optional.
+func (a *AuditLog) Record(actor auditActor, change RateSetChange) error {
+	if a == nil {
+		return nil
+	}
+	err := a.Append(AuditEntry{
+		Actor:           actor.Actor,
+		ClaimedActor:    actor.ClaimedActor,
+		Timestamp:       time.Now().UTC(),
+		RequestID:       actor.RequestID,
+		PreviousVersion: change.PreviousVersion,
+		Version:         change.Version,
+		Diff:            change.Diff,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: version %d: %v", errAuditWrite, change.Version, err)
+	}
+	return nil
+}
+
+// Returns up to limit entries starting at offset in the order they were written
+func (a *AuditLog) List(offset, limit int) (AuditPage, error) {
+	page := AuditPage{
+		Entries: []AuditEntry{},
+		Offset:  offset,
+		Limit:   limit,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	file, err := os.Open(a.path)
+	if err != nil {
+		return page, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if page.Total >= offset && len(page.Entries) < limit {
+			var entry AuditEntry
+			err = json.Unmarshal(scanner.Bytes(), &entry)
+			if err != nil {
+				return page, err
+			}
+			page.Entries = append(page.Entries, entry)
+		}
+		page.Total++
+	}
+	return page, scanner.Err()
+}
+
+func (a *AuditLog) Close() error {
+	return a.file.Close()
+}
+
+// The principal authenticated by the admin middleware, the X-Actor header is only recorded as a claim
+func actorFromRequest(r *http.Request) auditActor {
+	return auditActor{
+		Actor:        principalFromRequest(r),
+		ClaimedActor: r.Header.Get("X-Actor"),
+		RequestID:    requestIDFromRequest(r),
+	}
+}
+
+// A RateStore that can attribute the changes made through it
+type attributableRateStore interface {
+	As(actor auditActor) RateStore
+}
+
+// Returns store with its changes attributed to the maker of r, when store audits changes
+func ratesAs(store RateStore, r *http.Request) RateStore {
+	if attributable, ok := store.(attributableRateStore); ok {
+		return attributable.As(actorFromRequest(r))
+	}
+	return store
+}
+
+type AuditController struct {
+	Handler
+	log *AuditLog
+}
+
+func NewAuditController(log *AuditLog) *AuditController {
+	controller := AuditController{
+		Handler: Handler{},
+		log:     log,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetAudit)
+	return &controller
+}
+
+// GetAudit - Gets a page of the rate change audit log.
+// @Summary Gets a page of the rate change audit log.
+// @Description Gets a page of the rate change audit log, oldest entries first.
+// @Tags rates
+// @Produce json
+// @Param offset query int false "Entries to skip"
+// @Param limit query int false "Max entries to return, defaults to 50"
+// @Success 200 {object} AuditPage
+// @Failure 400 {object} Problem
+// @Failure 404 ""
+// @Failure 500 {object} Problem
+// @Router /rates/audit [get]
+func (c *AuditController) GetAudit(w http.ResponseWriter, r *http.Request) {
+	if c.log == nil {
+		webError(w, r, ErrRouteNotFound, "audit log is disabled")
+		return
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		webError(w, r, ErrBadQuery, "")
+		return
+	}
+	limit, err := queryInt(r, "limit", 50)
+	if err != nil || limit < 1 || limit > 500 {
+		webError(w, r, ErrBadQuery, "")
+		return
+	}
+
+	page, err := c.log.List(offset, limit)
+	if err != nil {
+		webError(w, r, ErrInternal, "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func queryInt(r *http.Request, key string, fallback int) (int, error) {
+	raw := r.URL.Query().Get(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(raw)
+}
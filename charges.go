@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Charge types, fees are worked out before taxes so a tax can include them
+const (
+	ChargeFee = "fee"
+	ChargeTax = "tax"
+)
+
+/*
+Example Charges, a $1.50 service fee and a 22% city parking tax that also applies to the fee:
+
+	"charges": [
+		{"name": "Service fee", "type": "fee", "amount": 150},
+		{"name": "City parking tax", "type": "tax", "percent": 22, "onFees": true}
+	]
+
+Exactly one of Percent or Amount is set. Percentages are accurate to a hundredth of a percent
+and every line item is rounded half up to a whole minor unit on its own.
+*/
+type Charge struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Percent float64 `json:"percent,omitempty"`
+	Amount  int     `json:"amount,omitempty"`
+	// percentage charges apply to the price plus every fee instead of just the price
+	OnFees bool `json:"onFees,omitempty"`
+}
+
+// A tax or fee on a quote
+type LineItem struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Amount int    `json:"amount"`
+}
+
+func (c Charge) Validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("'name' is required")
+	}
+	if c.Type != ChargeFee && c.Type != ChargeTax {
+		return fmt.Errorf("Invalid 'type' %q expected %s or %s", c.Type, ChargeFee, ChargeTax)
+	}
+	if (c.Percent == 0) == (c.Amount == 0) {
+		return errors.New("exactly one of 'percent' or 'amount' is required")
+	}
+	if c.Percent < 0 || c.Percent > 100 || c.Amount < 0 {
+		return errors.New("'percent' must be 0-100 and 'amount' must not be negative")
+	}
+	return nil
+}
+
+// Validates every charge, errors are reported with an Index of -1 as they don't belong to a rate
+func ValidateCharges(charges []Charge) []*RateValidationError {
+	var out []*RateValidationError
+	for i, v := range charges {
+		err := v.Validate()
+		if err != nil {
+			out = append(out, &RateValidationError{Index: -1, Err: fmt.Sprintf("Invalid charge %d: %v", i, err)})
+		}
+	}
+	return out
+}
+
+// returns the charge on base in minor units
+func (c Charge) amountOn(base int) int {
+	if c.Amount > 0 {
+		return c.Amount
+	}
+	basisPoints := int(math.Round(c.Percent * 100))
+	return (base*basisPoints + 5000) / 10000
+}
+
+// Adds the line items for charges to an available quote and totals it up
+func ApplyCharges(quote *Quote, charges []Charge) {
+	quote.LineItems = []LineItem{}
+	quote.Total = quote.Price
+	if !quote.Available {
+		return
+	}
+
+	fees := 0
+	for _, v := range charges {
+		if v.Type != ChargeFee {
+			continue
+		}
+		amount := v.amountOn(quote.Price)
+		fees += amount
+		quote.LineItems = append(quote.LineItems, LineItem{Name: v.Name, Type: v.Type, Amount: amount})
+	}
+	for _, v := range charges {
+		if v.Type != ChargeTax {
+			continue
+		}
+		base := quote.Price
+		if v.OnFees {
+			base += fees
+		}
+		quote.LineItems = append(quote.LineItems, LineItem{Name: v.Name, Type: v.Type, Amount: v.amountOn(base)})
+	}
+
+	for _, v := range quote.LineItems {
+		quote.Total += v.Amount
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "fmt"
+
+// Known vehicle classes and product tiers
+var (
+	vehicleClasses = []string{"car", "oversize", "motorcycle", "ev"}
+	productTiers   = []string{"standard", "valet", "covered"}
+)
+
+// The vehicle class and product tier a rate is for, or a request asks for. Empty means the default.
+type RateClass struct {
+	Vehicle string `json:"vehicle,omitempty"`
+	Product string `json:"product,omitempty"`
+}
+
+func (c RateClass) Validate() error {
+	if c.Vehicle != "" && !stringContains(vehicleClasses, c.Vehicle) {
+		return fmt.Errorf("Invalid 'vehicle' %q expected one of %v", c.Vehicle, vehicleClasses)
+	}
+	if c.Product != "" && !stringContains(productTiers, c.Product) {
+		return fmt.Errorf("Invalid 'product' %q expected one of %v", c.Product, productTiers)
+	}
+	return nil
+}
+
+// Reports whether a rate of this class can price a request for requested, a default rate serves every class
+func (c RateClass) Serves(requested RateClass) bool {
+	return (c.Vehicle == "" || c.Vehicle == requested.Vehicle) && (c.Product == "" || c.Product == requested.Product)
+}
+
+// number of class fields set, more specific rates win over defaults
+func (c RateClass) specificity() int {
+	n := 0
+	if c.Vehicle != "" {
+		n++
+	}
+	if c.Product != "" {
+		n++
+	}
+	return n
+}
+
+// Keeps only the most class specific of matches
+func preferClassSpecific(rates []Rate, matches []int) []int {
+	best := 0
+	for _, i := range matches {
+		if n := rates[i].RateClass.specificity(); n > best {
+			best = n
+		}
+	}
+	var out []int
+	for _, i := range matches {
+		if rates[i].RateClass.specificity() == best {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+func stringContains(strs []string, toFind string) bool {
+	for _, v := range strs {
+		if v == toFind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Replica roles
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// How far a replica is behind its leader, reported by /ready
+type SyncStatus struct {
+	Role          string    `json:"role"`
+	Leader        string    `json:"leader,omitempty"`
+	Version       int       `json:"version"`
+	LeaderVersion int       `json:"leaderVersion"`
+	LastSync      time.Time `json:"lastSync,omitempty"`
+	LastError     string    `json:"lastError,omitempty"`
+	InSync        bool      `json:"inSync"`
+}
+
+/*
+Keeps a follower's rates in line with a leader by polling the leader's GET /rates.
+Polls send the ETag of the last set installed as If-None-Match so an unchanged leader answers 304
+and a changed one sends the whole set, which is installed at the leader's version. The ETag holds
+a digest of the set, so a leader that restarted and reused a version still sends its new set.
+
+A follower counts as in sync while its version matches the leader's and the last poll
+succeeded within three intervals.
+*/
+type RateSync struct {
+	store    RateStore
+	leader   string
+	interval time.Duration
+	client   *http.Client
+	// called with every replicated change
+	OnChange func(RateSetChange)
+
+	mu            sync.RWMutex
+	etag          string
+	leaderVersion int
+	lastSync      time.Time
+	lastError     string
+}
+
+func NewRateSync(store RateStore, leader string, interval time.Duration) *RateSync {
+	return &RateSync{
+		store:    store,
+		leader:   strings.TrimRight(leader, "/"),
+		interval: interval,
+		client:   &http.Client{Timeout: interval},
+	}
+}
+
+// Polls the leader once, installing its rates when they have changed
+func (s *RateSync) SyncOnce() error {
+	err := s.poll()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.lastError = err.Error()
+		return err
+	}
+	s.lastError = ""
+	s.lastSync = time.Now()
+	return nil
+}
+
+func (s *RateSync) poll() error {
+	request, err := http.NewRequest(http.MethodGet, s.leader+"/rates", nil)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	if s.etag != "" {
+		request.Header.Set("If-None-Match", s.etag)
+	}
+	s.mu.RUnlock()
+	response, err := s.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	etag := response.Header.Get("ETag")
+	version, err := etagVersion(etag)
+	if err != nil {
+		return fmt.Errorf("leader sent invalid ETag %q", etag)
+	}
+	switch response.StatusCode {
+	case http.StatusNotModified:
+	case http.StatusOK:
+		var set Rates
+		err = json.NewDecoder(response.Body).Decode(&set)
+		if err != nil {
+			return err
+		}
+		change, err := s.store.Replicate(set, version)
+		if err != nil {
+			return err
+		}
+		if s.OnChange != nil {
+			s.OnChange(change)
+		}
+		log.Printf("sync: replicated rates version %d from %s", version, s.leader)
+	default:
+		return fmt.Errorf("leader answered %s", response.Status)
+	}
+
+	s.mu.Lock()
+	s.etag = etag
+	s.leaderVersion = version
+	s.mu.Unlock()
+	return nil
+}
+
+// Polls the leader every interval until stop is closed
+func (s *RateSync) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		err := s.SyncOnce()
+		if err != nil {
+			log.Printf("sync: polling %s: %v", s.leader, err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *RateSync) Status(now time.Time) SyncStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := SyncStatus{
+		Role:          RoleFollower,
+		Leader:        s.leader,
+		Version:       s.store.Version(),
+		LeaderVersion: s.leaderVersion,
+		LastSync:      s.lastSync,
+		LastError:     s.lastError,
+	}
+	status.InSync = !s.lastSync.IsZero() && now.Sub(s.lastSync) <= 3*s.interval && status.Version == status.LeaderVersion
+	return status
+}
+
+// Rejects rate changes on followers, they would be overwritten by the next sync
+func NewReadOnlyReplicaMiddleware(follower bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if follower && r.Method != http.MethodGet && r.Method != http.MethodHead {
+				webError(w, r, ErrReadOnlyReplica, "")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type ReadyController struct {
+	Handler
+	Rates RateStore
+	Sync  *RateSync
+}
+
+func NewReadyController(store RateStore, sync *RateSync) *ReadyController {
+	controller := ReadyController{
+		Handler: Handler{},
+		Rates:   store,
+		Sync:    sync,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetReady)
+	return &controller
+}
+
+// GetReady - Reports whether this replica is serving current rates.
+// @Summary Reports whether this replica is serving current rates.
+// @Description Leaders are always ready. Followers are ready while they match the leader's rate set version
+// @Description and have heard from it recently, otherwise this answers 503 so they are taken out of rotation.
+// @Tags cluster
+// @Produce json
+// @Success 200 {object} SyncStatus
+// @Failure 503 {object} SyncStatus
+// @Router /ready [get]
+func (c *ReadyController) GetReady(w http.ResponseWriter, r *http.Request) {
+	status := SyncStatus{Role: RoleLeader, Version: c.Rates.Version(), InSync: true}
+	status.LeaderVersion = status.Version
+	if c.Sync != nil {
+		status = c.Sync.Status(time.Now())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !status.InSync {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A weekday time window, expressed in the same "mon" / "0900-2100" format as Rate
+type CoverageInterval struct {
+	Day      string   `json:"day"`
+	Times    string   `json:"times"`
+	Timezone string   `json:"tz"`
+	RateIDs  []string `json:"rateIds,omitempty"`
+}
+
+// Weekly windows no rate covers, and windows more than one rate covers.
+// Each timezone in the rate set is analysed on its own, date overrides are not part of the weekly schedule.
+type Coverage struct {
+	Gaps     []CoverageInterval `json:"gaps"`
+	Overlaps []CoverageInterval `json:"overlaps"`
+}
+
+// Coverage of a single calendar day whose UTC offset changes, times are local wall clock times.
+type DateCoverage struct {
+	Date     string `json:"date"`
+	Timezone string `json:"tz"`
+	Coverage
+}
+
+// Weekly coverage plus the daylight savings transition days of a year.
+// GetRate adds rate times to local midnight as elapsed durations so on a 23 or 25 hour day
+// a "0900-2100" rate covers a different wall clock window than usual.
+type CoverageReport struct {
+	Coverage
+	Year           int            `json:"year"`
+	DSTTransitions []DateCoverage `json:"dstTransitions"`
+}
+
+var dayNames = []string{"sun", "mon", "tues", "wed", "thurs", "fri", "sat"}
+
+const minutesPerDay = 24 * 60
+
+// Computes the weekly coverage of rates at minute resolution, rates that fail validation are skipped.
+// Only default class rates count, vehicle and product specific rates sit on top of them.
+func AnalyzeCoverage(rates []Rate) Coverage {
+	coverage := newCoverage()
+	byTimezone := groupByTimezone(rates)
+
+	for _, tz := range sortedKeys(byTimezone) {
+		for day := range dayNames {
+			minutes := make([][]int, minutesPerDay)
+			for _, i := range byTimezone[tz] {
+				if len(rates[i].Dates) > 0 || rates[i].RateClass != (RateClass{}) {
+					continue
+				}
+				applies, err := rates[i].AppliesOn(weekday(day))
+				if err != nil || !applies {
+					continue
+				}
+				start, end, _ := rates[i].GetTimes()
+				cover(minutes, i, int(start.Minutes()), int(end.Minutes()))
+			}
+
+			coverage.add(rates, minutes, func(start, end int) CoverageInterval {
+				return CoverageInterval{
+					Day:      dayNames[day],
+					Times:    formatTimes(start, end),
+					Timezone: tz,
+				}
+			})
+		}
+	}
+	return coverage
+}
+
+// Computes weekly coverage along with the coverage of every DST transition day in year
+func AnalyzeCoverageReport(rates []Rate, year int) CoverageReport {
+	report := CoverageReport{
+		Coverage:       AnalyzeCoverage(rates),
+		Year:           year,
+		DSTTransitions: []DateCoverage{},
+	}
+	byTimezone := groupByTimezone(rates)
+
+	for _, tz := range sortedKeys(byTimezone) {
+		loc, _ := time.LoadLocation(tz)
+		for _, day := range dstTransitions(loc, year) {
+			length := int(day.AddDate(0, 0, 1).Sub(day).Minutes())
+			minutes := make([][]int, length)
+			overrides := make([][]int, length)
+			for _, i := range byTimezone[tz] {
+				if rates[i].RateClass != (RateClass{}) {
+					continue
+				}
+				applies, err := rates[i].AppliesOn(day)
+				if err != nil || !applies {
+					continue
+				}
+				// mirrors GetRate: offsets are elapsed time since local midnight
+				start, end, _ := rates[i].GetTimes()
+				if len(rates[i].Dates) > 0 {
+					cover(overrides, i, int(start.Minutes()), int(end.Minutes()))
+				} else {
+					cover(minutes, i, int(start.Minutes()), int(end.Minutes()))
+				}
+			}
+			for m := range overrides {
+				if len(overrides[m]) > 0 {
+					minutes[m] = overrides[m]
+				}
+			}
+
+			date := DateCoverage{
+				Date:     day.Format("2006-01-02"),
+				Timezone: tz,
+				Coverage: newCoverage(),
+			}
+			date.add(rates, minutes, func(start, end int) CoverageInterval {
+				return CoverageInterval{
+					Day:      dayNames[day.Weekday()],
+					Times:    wallClock(day, start, length) + "-" + wallClock(day, end, length),
+					Timezone: tz,
+				}
+			})
+			report.DSTTransitions = append(report.DSTTransitions, date)
+		}
+	}
+	return report
+}
+
+// a date falling on the given weekday, for checking weekday only rates
+func weekday(day int) time.Time {
+	// 2006-01-01 is a sunday
+	return time.Date(2006, 1, 1+day, 0, 0, 0, 0, time.UTC)
+}
+
+func newCoverage() Coverage {
+	return Coverage{
+		Gaps:     []CoverageInterval{},
+		Overlaps: []CoverageInterval{},
+	}
+}
+
+// Appends the gaps and overlaps in minutes, where minutes holds the indexes of the rates covering each minute.
+func (c *Coverage) add(rates []Rate, minutes [][]int, interval func(start, end int) CoverageInterval) {
+	for start := 0; start < len(minutes); {
+		end := start + 1
+		for end < len(minutes) && sameRates(minutes[start], minutes[end]) {
+			end++
+		}
+
+		switch {
+		case len(minutes[start]) == 0:
+			c.Gaps = append(c.Gaps, interval(start, end))
+		case len(minutes[start]) > 1:
+			overlap := interval(start, end)
+			for _, i := range minutes[start] {
+				overlap.RateIDs = append(overlap.RateIDs, rateLabel(rates, i))
+			}
+			c.Overlaps = append(c.Overlaps, overlap)
+		}
+		start = end
+	}
+}
+
+// marks minutes [start, end) as covered by rate i, clipped to the length of the day
+func cover(minutes [][]int, i, start, end int) {
+	if end > len(minutes) {
+		end = len(minutes)
+	}
+	for m := start; m < end; m++ {
+		covering := minutes[m]
+		if len(covering) > 0 && covering[len(covering)-1] == i {
+			continue
+		}
+		minutes[m] = append(covering, i)
+	}
+}
+
+// indexes of valid rates grouped by timezone
+func groupByTimezone(rates []Rate) map[string][]int {
+	out := map[string][]int{}
+	for i, v := range rates {
+		if v.Validate() != nil {
+			continue
+		}
+		out[v.Timezone] = append(out[v.Timezone], i)
+	}
+	return out
+}
+
+func sortedKeys(m map[string][]int) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Returns local midnight of every day in year that is not exactly 24 hours long
+func dstTransitions(loc *time.Location, year int) []time.Time {
+	var out []time.Time
+	day := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+	for day.Year() == year {
+		next := time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc)
+		if next.Sub(day) != 24*time.Hour {
+			out = append(out, day)
+		}
+		day = next
+	}
+	return out
+}
+
+func sameRates(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formats minute offsets as 0000-0000
+func formatTimes(start, end int) string {
+	return fmt.Sprintf("%02d%02d-%02d%02d", start/60, start%60, end/60, end%60)
+}
+
+// formats the wall clock time m minutes after midnight, the end of the day is 2400
+func wallClock(midnight time.Time, m, length int) string {
+	if m >= length {
+		return "2400"
+	}
+	return midnight.Add(time.Duration(m) * time.Minute).Format("1504")
+}
+
+// rates without IDs, such as unsaved candidates, are labelled by their position
+func rateLabel(rates []Rate, i int) string {
+	if strings.TrimSpace(rates[i].ID) != "" {
+		return rates[i].ID
+	}
+	return fmt.Sprintf("#%d", i)
+}
+
+type CoverageController struct {
+	Handler
+	Rates RateStore
+}
+
+func NewCoverageController(store RateStore) *CoverageController {
+	controller := CoverageController{
+		Handler: Handler{},
+		Rates:   store,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetCoverage)
+	return &controller
+}
+
+// GetCoverage - Reports coverage gaps and overlaps in the current rates.
+// @Summary Reports coverage gaps and overlaps in the current rates.
+// @Description Lists every weekday window that no rate or more than one rate covers, in each rate's own timezone.
+// @Description Daylight savings transition days of the requested year are reported separately in wall clock time.
+// @Tags rates
+// @Produce json
+// @Param year query int false "Year to check DST transitions for, defaults to the current year"
+// @Success 200 {object} CoverageReport
+// @Failure 400 {object} Problem
+// @Failure 404 ""
+// @Failure 500 {object} Problem
+// @Router /rates/coverage [get]
+func (c *CoverageController) GetCoverage(w http.ResponseWriter, r *http.Request) {
+	year, err := queryInt(r, "year", time.Now().Year())
+	if err != nil || year < 1 || year > 9999 {
+		webError(w, r, ErrBadQuery, "")
+		return
+	}
+
+	set, version := c.Rates.Snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(version))
+	json.NewEncoder(w).Encode(AnalyzeCoverageReport(set.Rates, year))
+}
+
+// rate-api coverage [-rates rates.json] [-year 2020]
+func runCoverage(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("coverage", flag.ContinueOnError)
+	path := flags.String("rates", ratesPath(), "rates file to analyse")
+	year := flags.Int("year", time.Now().Year(), "year to check DST transitions for")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	store, err := RateStoreFromFile(*path)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(AnalyzeCoverageReport(store.Get(), *year))
+}
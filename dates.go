@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Calendar date format used by Rate.Dates, ranges are written start/end and include both ends
+var DateFormat = "2006-01-02"
+
+// Parses a "2015-07-04" date or an inclusive "2015-06-01/2015-08-31" range into its first and last day
+func parseDateRange(s string) (time.Time, time.Time, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) > 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("Invalid 'dates' entry %q expected 2006-01-02 or 2006-01-02/2006-01-02", s)
+	}
+	first, err := time.Parse(DateFormat, parts[0])
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("Invalid 'dates' entry %q expected 2006-01-02 or 2006-01-02/2006-01-02", s)
+	}
+	last := first
+	if len(parts) == 2 {
+		last, err = time.Parse(DateFormat, parts[1])
+		if err != nil || last.Before(first) {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid 'dates' entry %q expected 2006-01-02 or 2006-01-02/2006-01-02", s)
+		}
+	}
+	return first, last, nil
+}
+
+// Reports whether the rate applies on the calendar day of t, t must already be in the rate's timezone.
+// Date overrides apply on their dates, further limited by Days when set. Unparseable dates or days are
+// returned as errors rather than treated as not applying.
+func (r Rate) AppliesOn(t time.Time) (bool, error) {
+	if len(r.Dates) > 0 {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		found := false
+		for _, v := range r.Dates {
+			first, last, err := parseDateRange(v)
+			if err != nil {
+				return false, err
+			}
+			if !day.Before(first) && !day.After(last) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+		if r.Days == "" {
+			return true, nil
+		}
+	}
+	weekdays, err := r.GetDays()
+	if err != nil {
+		return false, err
+	}
+	return IntContains(weekdays, int(t.Weekday())), nil
+}
+
+// Date overrides take precedence, if any of matches is one only those are kept
+func preferDateOverrides(rates []Rate, matches []int) []int {
+	var overrides []int
+	for _, i := range matches {
+		if len(rates[i].Dates) > 0 {
+			overrides = append(overrides, i)
+		}
+	}
+	if len(overrides) > 0 {
+		return overrides
+	}
+	return matches
+}
+
+// Reads the all day or timed events of an iCalendar file as Rate.Dates entries.
+// Recurrence rules are not expanded, every occurrence must be its own VEVENT.
+func ParseICalendarDates(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// folded lines continue the previous line
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+
+	out := []string{}
+	inEvent := false
+	var start, end string
+	var endIsDate bool
+	for _, line := range lines {
+		name, value := icsProperty(line)
+		switch {
+		case line == "BEGIN:VEVENT":
+			inEvent, start, end, endIsDate = true, "", "", false
+		case line == "END:VEVENT":
+			if start == "" {
+				return nil, fmt.Errorf("calendar event without DTSTART")
+			}
+			entry, err := icsDates(start, end, endIsDate)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, entry)
+			inEvent = false
+		case inEvent && name == "DTSTART":
+			start = value
+		case inEvent && name == "DTEND":
+			end = value
+			endIsDate = len(value) == 8
+		}
+	}
+	return out, nil
+}
+
+// splits "DTSTART;VALUE=DATE:20150704" into "DTSTART" and "20150704"
+func icsProperty(line string) (string, string) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", ""
+	}
+	name := line[:i]
+	if j := strings.Index(name, ";"); j >= 0 {
+		name = name[:j]
+	}
+	return strings.ToUpper(name), line[i+1:]
+}
+
+// converts event start/end values into a Rate.Dates entry, all day DTEND values are exclusive
+func icsDates(start, end string, endIsDate bool) (string, error) {
+	if len(start) < 8 {
+		return "", fmt.Errorf("invalid calendar DTSTART %q", start)
+	}
+	first, err := time.Parse("20060102", start[:8])
+	if err != nil {
+		return "", fmt.Errorf("invalid calendar DTSTART %q", start)
+	}
+	last := first
+	if len(end) >= 8 {
+		last, err = time.Parse("20060102", end[:8])
+		if err != nil {
+			return "", fmt.Errorf("invalid calendar DTEND %q", end)
+		}
+		if endIsDate {
+			last = last.AddDate(0, 0, -1)
+		}
+	}
+	if !last.After(first) {
+		return first.Format(DateFormat), nil
+	}
+	return first.Format(DateFormat) + "/" + last.Format(DateFormat), nil
+}
+
+// Replaces each rate's Calendar file reference with the dates it contains, paths are relative to dir.
+// Only rate files are resolved this way, the api never reads calendar files on a client's behalf.
+func resolveCalendars(rates []Rate, dir string) error {
+	for i, v := range rates {
+		if v.Calendar == "" {
+			continue
+		}
+		path := v.Calendar
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		dates, err := ParseICalendarDates(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", v.Calendar, err)
+		}
+		rates[i].Dates = append(v.Dates, dates...)
+		rates[i].Calendar = ""
+	}
+	return nil
+}
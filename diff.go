@@ -0,0 +1,85 @@
+package main
+
+import "reflect"
+
+// Structured difference between two rate sets, rates are matched by ID
+type RateDiff struct {
+	Added   []Rate         `json:"added"`
+	Removed []Rate         `json:"removed"`
+	Changed []RateChange   `json:"changed"`
+	Policy  *PolicyChange  `json:"policy,omitempty"`
+	Charges *ChargesChange `json:"charges,omitempty"`
+}
+
+type PolicyChange struct {
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+type ChargesChange struct {
+	Before []Charge `json:"before"`
+	After  []Charge `json:"after"`
+}
+
+// Describes a single committed update to a RateStore
+type RateSetChange struct {
+	PreviousVersion int      `json:"previousVersion"`
+	Version         int      `json:"version"`
+	Diff            RateDiff `json:"diff"`
+}
+
+type RateChange struct {
+	ID     string `json:"id"`
+	Before Rate   `json:"before"`
+	After  Rate   `json:"after"`
+}
+
+func (d RateDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && d.Policy == nil && d.Charges == nil
+}
+
+// Compares two rate set documents, including their set level settings
+func DiffRateSets(current, candidate Rates) RateDiff {
+	diff := DiffRates(current.Rates, candidate.Rates)
+	if current.Policy != candidate.Policy {
+		diff.Policy = &PolicyChange{Before: current.Policy, After: candidate.Policy}
+	}
+	if len(current.Charges)+len(candidate.Charges) > 0 && !reflect.DeepEqual(current.Charges, candidate.Charges) {
+		diff.Charges = &ChargesChange{Before: current.Charges, After: candidate.Charges}
+	}
+	return diff
+}
+
+// Compares current to candidate, candidate rates without an ID are always reported as added.
+func DiffRates(current, candidate []Rate) RateDiff {
+	diff := RateDiff{
+		Added:   []Rate{},
+		Removed: []Rate{},
+		Changed: []RateChange{},
+	}
+
+	candidateIDs := make(map[string]bool, len(candidate))
+	for _, v := range candidate {
+		if v.ID == "" {
+			diff.Added = append(diff.Added, v)
+			continue
+		}
+		candidateIDs[v.ID] = true
+
+		i := indexOfRate(current, v.ID)
+		if i < 0 {
+			diff.Added = append(diff.Added, v)
+			continue
+		}
+		if !reflect.DeepEqual(current[i], v) {
+			diff.Changed = append(diff.Changed, RateChange{ID: v.ID, Before: current[i], After: v})
+		}
+	}
+
+	for _, v := range current {
+		if !candidateIDs[v.ID] {
+			diff.Removed = append(diff.Removed, v)
+		}
+	}
+	return diff
+}
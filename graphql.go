@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+/*
+Example query, rates on wednesdays plus quotes for two spans in one round trip:
+
+	{
+		version
+		rates(day: "wed", tz: "America/Chicago", maxPrice: 2000) { id days times price }
+		quotes(spans: [
+			{start: "2015-07-01T07:00:00-05:00", end: "2015-07-01T12:00:00-05:00"},
+			{start: "2015-07-04T15:00:00+00:00", end: "2015-07-04T20:00:00+00:00", vehicle: "oversize"}
+		]) { available price total rateId }
+	}
+
+Mutations need the admin token like the gRPC SetRates call and must be POSTed as application/json,
+so a link or a cross site form can't change rates.
+*/
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// carries the http request into resolvers
+type graphqlRequestKey struct{}
+
+type GraphQLController struct {
+	Handler
+	schema graphql.Schema
+}
+
+func NewGraphQLController(s *services) (*GraphQLController, error) {
+	schema, err := newGraphQLSchema(s)
+	if err != nil {
+		return nil, err
+	}
+	controller := GraphQLController{
+		Handler: Handler{},
+		schema:  schema,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.ServeGraphQL)
+	controller.Handler[http.MethodPost] = http.HandlerFunc(controller.ServeGraphQL)
+	return &controller, nil
+}
+
+// ServeGraphQL - Runs a GraphQL query or mutation.
+// @Summary Runs a GraphQL query or mutation.
+// @Description Queries rates (filterable by day, tz and price), the rate set version and policy, a quote or a batch of quotes.
+// @Description Mutations setRates, addRate, updateRate and deleteRate need the admin token and are rejected on follower replicas.
+// @Description GET takes the query as the query parameter and can't run mutations, POST bodies must be application/json.
+// @Description Errors are reported in the response's errors list.
+// @Tags graphql
+// @Accept json
+// @Produce json
+// @Param GraphQLRequest body GraphQLRequest true "Query"
+// @Success 200 ""
+// @Failure 400 {object} Problem
+// @Failure 405 {object} Problem
+// @Failure 415 {object} Problem
+// @Router /graphql [post]
+func (c *GraphQLController) ServeGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req GraphQLRequest
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+	} else {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" {
+			webError(w, r, ErrUnsupportedMedia, "send the request as application/json")
+			return
+		}
+		if r.Body == nil {
+			webError(w, r, ErrMissingBody, "")
+			return
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			webError(w, r, ErrBadBody, err.Error())
+			return
+		}
+	}
+	if req.Query == "" {
+		webError(w, r, ErrBadBody, "")
+		return
+	}
+	if r.Method == http.MethodGet && graphqlMutates(req.Query, req.OperationName) {
+		w.Header().Set("Allow", http.MethodPost)
+		webError(w, r, ErrMethodNotAllowed, "mutations must be sent with POST")
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         c.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        context.WithValue(r.Context(), graphqlRequestKey{}, r),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Reports whether the operation the request runs is a mutation. Without an operationName every
+// operation in the document counts, documents that don't parse are left for graphql.Do to report.
+func graphqlMutates(query, operationName string) bool {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return false
+	}
+	for _, v := range doc.Definitions {
+		op, ok := v.(*ast.OperationDefinition)
+		if !ok || op.Operation != ast.OperationTypeMutation {
+			continue
+		}
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return true
+		}
+	}
+	return false
+}
+
+func newGraphQLSchema(s *services) (graphql.Schema, error) {
+	pricingType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Pricing",
+		Fields: graphql.Fields{
+			"model":            &graphql.Field{Type: graphql.String},
+			"incrementMinutes": &graphql.Field{Type: graphql.Int},
+			"incrementPrice":   &graphql.Field{Type: graphql.Int},
+			"firstHourPrice":   &graphql.Field{Type: graphql.Int},
+			"rounding":         &graphql.Field{Type: graphql.String},
+			"maxPrice":         &graphql.Field{Type: graphql.Int},
+		},
+	})
+	surgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SurgeBounds",
+		Fields: graphql.Fields{
+			"floor":   &graphql.Field{Type: graphql.Int},
+			"ceiling": &graphql.Field{Type: graphql.Int},
+		},
+	})
+	rateType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Rate",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.ID},
+			"price":       &graphql.Field{Type: graphql.Int},
+			"tz":          &graphql.Field{Type: graphql.String},
+			"times":       &graphql.Field{Type: graphql.String},
+			"days":        &graphql.Field{Type: graphql.String},
+			"priority":    &graphql.Field{Type: graphql.Int},
+			"pricing":     &graphql.Field{Type: pricingType},
+			"dates":       &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"calendar":    &graphql.Field{Type: graphql.String},
+			"minDuration": &graphql.Field{Type: graphql.String},
+			"maxDuration": &graphql.Field{Type: graphql.String},
+			"vehicle":     &graphql.Field{Type: graphql.String},
+			"product":     &graphql.Field{Type: graphql.String},
+			"surge":       &graphql.Field{Type: surgeType},
+		},
+	})
+	lineItemType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "LineItem",
+		Fields: graphql.Fields{
+			"name":   &graphql.Field{Type: graphql.String},
+			"type":   &graphql.Field{Type: graphql.String},
+			"amount": &graphql.Field{Type: graphql.Int},
+		},
+	})
+	quoteType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Quote",
+		Fields: graphql.Fields{
+			"startDate":       &graphql.Field{Type: graphql.String},
+			"endDate":         &graphql.Field{Type: graphql.String},
+			"minutes":         &graphql.Field{Type: graphql.Int},
+			"available":       &graphql.Field{Type: graphql.Boolean},
+			"rateId":          &graphql.Field{Type: graphql.ID},
+			"policy":          &graphql.Field{Type: graphql.String},
+			"matchedRateIds":  &graphql.Field{Type: graphql.NewList(graphql.ID)},
+			"vehicle":         &graphql.Field{Type: graphql.String},
+			"product":         &graphql.Field{Type: graphql.String},
+			"basePrice":       &graphql.Field{Type: graphql.Int},
+			"surgeFactor":     &graphql.Field{Type: graphql.Float},
+			"surgeAdjustment": &graphql.Field{Type: graphql.Int},
+			"discount":        &graphql.Field{Type: graphql.Int},
+			"promoCode":       &graphql.Field{Type: graphql.String},
+			"promoError":      &graphql.Field{Type: graphql.String},
+			"price":           &graphql.Field{Type: graphql.Int},
+			"lineItems":       &graphql.Field{Type: graphql.NewList(lineItemType)},
+			"total":           &graphql.Field{Type: graphql.Int},
+			"reason":          &graphql.Field{Type: graphql.String},
+			"version":         &graphql.Field{Type: graphql.Int},
+		},
+	})
+	rateSetType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "RateSet",
+		Fields: graphql.Fields{
+			"version": &graphql.Field{Type: graphql.Int},
+			"policy":  &graphql.Field{Type: graphql.String},
+			"rates":   &graphql.Field{Type: graphql.NewList(rateType)},
+		},
+	})
+
+	pricingInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "PricingInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"model":            &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"incrementMinutes": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"incrementPrice":   &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"firstHourPrice":   &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"rounding":         &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"maxPrice":         &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		},
+	})
+	surgeInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "SurgeBoundsInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"floor":   &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"ceiling": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+		},
+	})
+	rateInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "RateInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"id":          &graphql.InputObjectFieldConfig{Type: graphql.ID},
+			"price":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Int)},
+			"tz":          &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"times":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"days":        &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"priority":    &graphql.InputObjectFieldConfig{Type: graphql.Int},
+			"pricing":     &graphql.InputObjectFieldConfig{Type: pricingInput},
+			"dates":       &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String))},
+			"calendar":    &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"minDuration": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"maxDuration": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"vehicle":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"product":     &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"surge":       &graphql.InputObjectFieldConfig{Type: surgeInput},
+		},
+	})
+	spanInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "SpanInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"start":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"end":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"promoCode": &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"vehicle":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+			"product":   &graphql.InputObjectFieldConfig{Type: graphql.String},
+		},
+	})
+	spanArgs := graphql.FieldConfigArgument{
+		"start":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		"end":       &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+		"promoCode": &graphql.ArgumentConfig{Type: graphql.String},
+		"vehicle":   &graphql.ArgumentConfig{Type: graphql.String},
+		"product":   &graphql.ArgumentConfig{Type: graphql.String},
+	}
+	ifVersionArg := &graphql.ArgumentConfig{Type: graphql.Int, Description: "expected rate set version, like If-Match"}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"version": &graphql.Field{
+				Type: graphql.Int,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return s.rates.Version(), nil
+				},
+			},
+			"policy": &graphql.Field{
+				Type: graphql.String,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					set, _ := s.rates.Snapshot()
+					if set.Policy == "" {
+						return PolicyFirstMatch, nil
+					}
+					return set.Policy, nil
+				},
+			},
+			"rates": &graphql.Field{
+				Type: graphql.NewList(rateType),
+				Args: graphql.FieldConfigArgument{
+					"day":      &graphql.ArgumentConfig{Type: graphql.String, Description: "only rates that apply on this day, e.g. wed"},
+					"tz":       &graphql.ArgumentConfig{Type: graphql.String},
+					"minPrice": &graphql.ArgumentConfig{Type: graphql.Int},
+					"maxPrice": &graphql.ArgumentConfig{Type: graphql.Int},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					rates, err := filterRates(s.rates.Get(), p.Args)
+					if err != nil {
+						return nil, graphqlError(ErrBadQuery, err.Error())
+					}
+					return toGraphQL(rates)
+				},
+			},
+			"quote": &graphql.Field{
+				Type: quoteType,
+				Args: spanArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					req, err := graphqlRateRequest(p.Args)
+					if err != nil {
+						return nil, graphqlError(ErrInvalidSpan, err.Error())
+					}
+					quote, err := s.quoter.Quote(req)
+					if err != nil {
+						return nil, graphqlError(ErrRateData, err.Error())
+					}
+					return toGraphQL(quote)
+				},
+			},
+			"quotes": &graphql.Field{
+				Type: graphql.NewList(quoteType),
+				Args: graphql.FieldConfigArgument{
+					"spans": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(spanInput)))},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var reqs []RateRequest
+					for _, v := range p.Args["spans"].([]interface{}) {
+						req, err := graphqlRateRequest(v.(map[string]interface{}))
+						if err != nil {
+							return nil, graphqlError(ErrInvalidSpan, err.Error())
+						}
+						reqs = append(reqs, req)
+					}
+					quotes, err := s.quoter.QuoteBatch(reqs)
+					if err != nil {
+						return nil, graphqlError(ErrRateData, err.Error())
+					}
+					return toGraphQL(quotes)
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"setRates": &graphql.Field{
+				Type: rateSetType,
+				Args: graphql.FieldConfigArgument{
+					"rates":     &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(rateInput)))},
+					"policy":    &graphql.ArgumentConfig{Type: graphql.String},
+					"ifVersion": ifVersionArg,
+				},
+				Resolve: s.graphqlMutation(func(p graphql.ResolveParams, rates RateStore, ifVersion int) (interface{}, error) {
+					current, _ := rates.Snapshot()
+					candidate := Rates{Policy: current.Policy, Charges: current.Charges}
+					if policy, ok := p.Args["policy"].(string); ok {
+						candidate.Policy = policy
+					}
+					err := fromGraphQL(p.Args["rates"], &candidate.Rates)
+					if err != nil {
+						return nil, err
+					}
+					errs := candidate.Validate()
+					if len(errs) > 0 {
+						return nil, errors.New(errs[0].Error())
+					}
+					_, err = rates.Set(candidate, ifVersion)
+					if err != nil {
+						return nil, err
+					}
+					set, version := rates.Snapshot()
+					out, err := toGraphQL(set)
+					if m, ok := out.(map[string]interface{}); ok {
+						m["version"] = version
+					}
+					return out, err
+				}),
+			},
+			"addRate": &graphql.Field{
+				Type: rateType,
+				Args: graphql.FieldConfigArgument{
+					"rate":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(rateInput)},
+					"ifVersion": ifVersionArg,
+				},
+				Resolve: s.graphqlMutation(func(p graphql.ResolveParams, rates RateStore, ifVersion int) (interface{}, error) {
+					var rate Rate
+					err := fromGraphQL(p.Args["rate"], &rate)
+					if err == nil {
+						err = rate.Validate()
+					}
+					if err != nil {
+						return nil, err
+					}
+					rate, _, err = rates.Add(rate, ifVersion)
+					if err != nil {
+						return nil, err
+					}
+					return toGraphQL(rate)
+				}),
+			},
+			"updateRate": &graphql.Field{
+				Type: rateType,
+				Args: graphql.FieldConfigArgument{
+					"id":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"rate":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(rateInput)},
+					"ifVersion": ifVersionArg,
+				},
+				Resolve: s.graphqlMutation(func(p graphql.ResolveParams, rates RateStore, ifVersion int) (interface{}, error) {
+					var rate Rate
+					err := fromGraphQL(p.Args["rate"], &rate)
+					if err != nil {
+						return nil, err
+					}
+					rate, _, err = rates.Update(p.Args["id"].(string), ifVersion, func(existing *Rate) error {
+						*existing = rate
+						return existing.Validate()
+					})
+					if err != nil {
+						return nil, err
+					}
+					return toGraphQL(rate)
+				}),
+			},
+			"deleteRate": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "returns the new rate set version",
+				Args: graphql.FieldConfigArgument{
+					"id":        &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"ifVersion": ifVersionArg,
+				},
+				Resolve: s.graphqlMutation(func(p graphql.ResolveParams, rates RateStore, ifVersion int) (interface{}, error) {
+					change, err := rates.Delete(p.Args["id"].(string), ifVersion)
+					return change.Version, err
+				}),
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// Wraps a mutation resolver with the admin token and follower checks, resolve gets the rates attributed to the caller
+func (s *services) graphqlMutation(resolve func(p graphql.ResolveParams, rates RateStore, ifVersion int) (interface{}, error)) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		r, _ := p.Context.Value(graphqlRequestKey{}).(*http.Request)
+		if r == nil || !adminAuthorized(r, s.adminToken) {
+			return nil, graphqlError(ErrUnauthorized, "")
+		}
+		if s.sync != nil {
+			return nil, graphqlError(ErrReadOnlyReplica, "")
+		}
+		ifVersion := AnyVersion
+		if v, ok := p.Args["ifVersion"].(int); ok {
+			ifVersion = v
+		}
+
+		out, err := resolve(p, ratesAs(s.rates, withAdminPrincipal(r)), ifVersion)
+		if err != nil {
+			return nil, storeGraphQLError(err)
+		}
+		return out, nil
+	}
+}
+
+// A GraphQL error carrying a catalog code in its extensions, like the problem+json code of the http api
+type codedGraphQLError struct {
+	code   ErrorCode
+	detail string
+}
+
+func graphqlError(code ErrorCode, detail string) error {
+	return &codedGraphQLError{code, detail}
+}
+
+func (e *codedGraphQLError) Error() string {
+	if e.detail != "" {
+		return e.code.Title + ": " + e.detail
+	}
+	return e.code.Title
+}
+
+func (e *codedGraphQLError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code.Code}
+}
+
+// maps a store error to the catalog, anything else is a validation failure of the changed rates
+func storeGraphQLError(err error) error {
+	if errors.Is(err, errAuditWrite) {
+		return graphqlError(ErrInternal, errAuditWrite.Error())
+	}
+	switch err {
+	case errRateNotFound:
+		return graphqlError(ErrNotFound, "")
+	case errVersionMismatch:
+		return graphqlError(ErrPrecondition, "")
+	case errDuplicateRateID:
+		return graphqlError(ErrConflict, "")
+	case errRateStorage:
+		return graphqlError(ErrInternal, "")
+	default:
+		return graphqlError(ErrInvalidRate, err.Error())
+	}
+}
+
+func filterRates(rates []Rate, args map[string]interface{}) ([]Rate, error) {
+	out := []Rate{}
+	day := -1
+	if name, ok := args["day"].(string); ok {
+		var found bool
+		day, found = parseDay(strings.ToLower(strings.TrimSpace(name)))
+		if !found {
+			return nil, errors.New("Invalid 'day' " + name)
+		}
+	}
+	for _, v := range rates {
+		if tz, ok := args["tz"].(string); ok && v.Timezone != tz {
+			continue
+		}
+		if min, ok := args["minPrice"].(int); ok && v.Price < min {
+			continue
+		}
+		if max, ok := args["maxPrice"].(int); ok && v.Price > max {
+			continue
+		}
+		if day >= 0 {
+			days, err := v.GetDays()
+			if err != nil || !IntContains(days, day) {
+				continue
+			}
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func graphqlRateRequest(args map[string]interface{}) (RateRequest, error) {
+	req := RateRequest{}
+	for key, target := range map[string]*ISO8601Time{"start": &req.StartDate, "end": &req.EndDate} {
+		value, _ := args[key].(string)
+		t, err := time.Parse(ISO8601, value)
+		if err != nil {
+			return req, errors.New("Invalid '" + key + "' expected " + ISO8601)
+		}
+		*target = ISO8601Time{t}
+	}
+	req.PromoCode, _ = args["promoCode"].(string)
+	req.Vehicle, _ = args["vehicle"].(string)
+	req.Product, _ = args["product"].(string)
+	return req, req.Validate()
+}
+
+// converts v to plain maps and lists through its json form, so resolvers use the json field names
+func toGraphQL(v interface{}) (interface{}, error) {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	err = json.Unmarshal(out, &value)
+	return value, err
+}
+
+// fills out from graphql input arguments, which use the json field names
+func fromGraphQL(args interface{}, out interface{}) error {
+	in, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(in, out)
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Ashtonian/rate-api/rpc/ratepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpc methods that change rates, guarded by the admin token like the promo endpoints
+var grpcAdminMethods = map[string]bool{
+	ratepb.RateService_SetRates_FullMethodName: true,
+}
+
+// http status recorded in metrics for each grpc code, so both apis share one status breakdown
+var grpcHTTPStatus = map[codes.Code]int{
+	codes.OK:                 200,
+	codes.InvalidArgument:    400,
+	codes.Unauthenticated:    401,
+	codes.PermissionDenied:   403,
+	codes.NotFound:           404,
+	codes.AlreadyExists:      409,
+	codes.FailedPrecondition: 412,
+	codes.Canceled:           499,
+	codes.Unavailable:        503,
+}
+
+// Serves the RateService from the same stores as the http api
+type RateGRPCServer struct {
+	ratepb.UnimplementedRateServiceServer
+	services *services
+}
+
+func (s *services) grpcServer(metricsStore *MetricsStore) *grpc.Server {
+	guard := grpcGuard(s.adminToken, s.sync != nil)
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcUnaryRecovery, grpcUnaryMetrics(metricsStore), grpcUnaryGuard(guard)),
+		grpc.ChainStreamInterceptor(grpcStreamRecovery, grpcStreamMetrics(metricsStore), grpcStreamGuard(guard)),
+	)
+	ratepb.RegisterRateServiceServer(server, &RateGRPCServer{services: s})
+	return server
+}
+
+func (s *RateGRPCServer) GetRate(ctx context.Context, req *ratepb.GetRateRequest) (*ratepb.GetRateResponse, error) {
+	out, err := s.BatchGetRate(ctx, &ratepb.BatchGetRateRequest{Requests: []*ratepb.GetRateRequest{req}})
+	if err != nil {
+		return nil, err
+	}
+	return out.Responses[0], nil
+}
+
+func (s *RateGRPCServer) BatchGetRate(ctx context.Context, req *ratepb.BatchGetRateRequest) (*ratepb.BatchGetRateResponse, error) {
+	reqs := make([]RateRequest, 0, len(req.Requests))
+	for _, v := range req.Requests {
+		if v.Start == nil || v.End == nil {
+			return nil, status.Error(codes.InvalidArgument, "start and end are required")
+		}
+		rateRequest := RateRequest{
+			StartDate: ISO8601Time{v.Start.AsTime()},
+			EndDate:   ISO8601Time{v.End.AsTime()},
+			PromoCode: v.PromoCode,
+			RateClass: RateClass{Vehicle: v.Vehicle, Product: v.Product},
+		}
+		err := rateRequest.Validate()
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		reqs = append(reqs, rateRequest)
+	}
+
+	quotes, err := s.services.quoter.QuoteBatch(reqs)
+	if err != nil {
+		return nil, status.Error(codes.Internal, ErrInternal.Title)
+	}
+	out := &ratepb.BatchGetRateResponse{}
+	for _, v := range quotes {
+		out.Responses = append(out.Responses, quoteToPB(v))
+	}
+	return out, nil
+}
+
+func (s *RateGRPCServer) ListRates(ctx context.Context, req *ratepb.ListRatesRequest) (*ratepb.RateSet, error) {
+	set, version := s.services.rates.Snapshot()
+	return rateSetToPB(set, version), nil
+}
+
+func (s *RateGRPCServer) SetRates(ctx context.Context, req *ratepb.SetRatesRequest) (*ratepb.RateSet, error) {
+	if req.Rates == nil {
+		return nil, status.Error(codes.InvalidArgument, "rates are required")
+	}
+	candidate := rateSetFromPB(req.Rates)
+	errs := candidate.Validate()
+	if len(errs) > 0 {
+		return nil, status.Error(codes.InvalidArgument, errs[0].Error())
+	}
+	ifVersion := AnyVersion
+	if req.IfVersion != nil {
+		ifVersion = int(*req.IfVersion)
+	}
+
+	_, err := s.services.rates.(attributableRateStore).As(grpcActor(ctx)).Set(candidate, ifVersion)
+	if err != nil {
+		return nil, grpcStoreError(err)
+	}
+	set, version := s.services.rates.Snapshot()
+	return rateSetToPB(set, version), nil
+}
+
+func (s *RateGRPCServer) WatchRates(req *ratepb.WatchRatesRequest, stream ratepb.RateService_WatchRatesServer) error {
+	changes, unsubscribe := s.services.broadcaster.Subscribe()
+	defer unsubscribe()
+
+	sent := -1
+	if req.SinceVersion != nil {
+		sent = int(*req.SinceVersion)
+	}
+	send := func() error {
+		set, version := s.services.rates.Snapshot()
+		if version == sent {
+			return nil
+		}
+		sent = version
+		return stream.Send(rateSetToPB(set, version))
+	}
+
+	err := send()
+	for err == nil {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case _, open := <-changes:
+			if !open {
+				return status.Error(codes.Unavailable, "fell behind on rate changes, watch again from the last version")
+			}
+			// send compares versions for equality so a store that went back a version is still sent
+			err = send()
+		}
+	}
+	return err
+}
+
+func grpcStoreError(err error) error {
+	if errors.Is(err, errAuditWrite) {
+		return status.Error(codes.Internal, errAuditWrite.Error())
+	}
+	switch err {
+	case errVersionMismatch:
+		return status.Error(codes.FailedPrecondition, ErrPrecondition.Title)
+	case errDuplicateRateID:
+		return status.Error(codes.AlreadyExists, ErrConflict.Title)
+	case errRateStorage:
+		return status.Error(codes.Internal, ErrInternal.Title)
+	default:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+}
+
+// checks the admin token and follower read only rule for a method
+func grpcGuard(token string, follower bool) func(ctx context.Context, method string) error {
+	return func(ctx context.Context, method string) error {
+		if !grpcAdminMethods[method] {
+			return nil
+		}
+		// no token refuses every admin call rather than leaving them open
+		auth := grpcMetadata(ctx, "authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) != 1 {
+			return status.Error(codes.Unauthenticated, ErrUnauthorized.Title)
+		}
+		if follower {
+			return status.Error(codes.PermissionDenied, ErrReadOnlyReplica.Title)
+		}
+		return nil
+	}
+}
+
+func grpcUnaryGuard(guard func(context.Context, string) error) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		err := guard(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func grpcStreamGuard(guard func(context.Context, string) error) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := guard(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+func grpcUnaryMetrics(store *MetricsStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		recordGRPC(store, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func grpcStreamMetrics(store *MetricsStore) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		recordGRPC(store, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func recordGRPC(store *MetricsStore, method string, start time.Time, err error) {
+	duration := time.Since(start).Milliseconds()
+	if duration < 1 {
+		duration = 1
+	}
+	code, found := grpcHTTPStatus[status.Code(err)]
+	if !found {
+		code = 500
+	}
+	store.Record("GRPC", method, code, int(duration))
+}
+
+func grpcUnaryRecovery(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("panic in %s: %v", info.FullMethod, recovered)
+			err = status.Error(codes.Internal, ErrInternal.Title)
+		}
+	}()
+	return handler(ctx, req)
+}
+
+func grpcStreamRecovery(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			log.Printf("panic in %s: %v", info.FullMethod, recovered)
+			err = status.Error(codes.Internal, ErrInternal.Title)
+		}
+	}()
+	return handler(srv, stream)
+}
+
+func grpcMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// Who made an admin call, the guard has checked the token by now. The x-actor metadata is only
+// a claim like the X-Actor header over http.
+func grpcActor(ctx context.Context) auditActor {
+	return auditActor{
+		Actor:        adminPrincipal,
+		ClaimedActor: grpcMetadata(ctx, "x-actor"),
+		RequestID:    grpcRequestID(ctx),
+	}
+}
+
+func grpcRequestID(ctx context.Context) string {
+	id := grpcMetadata(ctx, "x-request-id")
+	if id == "" {
+		return newRateID()
+	}
+	return id
+}
+
+func quoteToPB(quote Quote) *ratepb.GetRateResponse {
+	out := &ratepb.GetRateResponse{
+		Available:       quote.Available,
+		RateId:          quote.RateID,
+		Reason:          quote.Reason,
+		BasePrice:       int64(quote.BasePrice),
+		SurgeAdjustment: int64(quote.SurgeAdjustment),
+		Discount:        int64(quote.Discount),
+		PromoError:      quote.PromoError,
+		Price:           int64(quote.Price),
+		Total:           int64(quote.Total),
+		Version:         int64(quote.Version),
+	}
+	for _, v := range quote.LineItems {
+		out.LineItems = append(out.LineItems, &ratepb.LineItem{Name: v.Name, Type: v.Type, Amount: int64(v.Amount)})
+	}
+	return out
+}
+
+func rateSetToPB(set Rates, version int) *ratepb.RateSet {
+	out := &ratepb.RateSet{
+		Policy:  set.Policy,
+		Version: int64(version),
+	}
+	for _, v := range set.Rates {
+		out.Rates = append(out.Rates, rateToPB(v))
+	}
+	for _, v := range set.Charges {
+		out.Charges = append(out.Charges, &ratepb.Charge{Name: v.Name, Type: v.Type, Percent: v.Percent, Amount: int64(v.Amount), OnFees: v.OnFees})
+	}
+	return out
+}
+
+func rateSetFromPB(set *ratepb.RateSet) Rates {
+	out := Rates{
+		Rates:  []Rate{},
+		Policy: set.Policy,
+	}
+	for _, v := range set.Rates {
+		out.Rates = append(out.Rates, rateFromPB(v))
+	}
+	for _, v := range set.Charges {
+		out.Charges = append(out.Charges, Charge{Name: v.Name, Type: v.Type, Percent: v.Percent, Amount: int(v.Amount), OnFees: v.OnFees})
+	}
+	return out
+}
+
+func rateToPB(rate Rate) *ratepb.Rate {
+	out := &ratepb.Rate{
+		Id:          rate.ID,
+		Price:       int64(rate.Price),
+		Tz:          rate.Timezone,
+		Times:       rate.Times,
+		Days:        rate.Days,
+		Priority:    int64(rate.Priority),
+		Dates:       rate.Dates,
+		MinDuration: rate.MinDuration,
+		MaxDuration: rate.MaxDuration,
+		Vehicle:     rate.Vehicle,
+		Product:     rate.Product,
+	}
+	if p := rate.Pricing; p != nil {
+		out.Pricing = &ratepb.Pricing{
+			Model:            p.Model,
+			IncrementMinutes: int64(p.IncrementMinutes),
+			IncrementPrice:   int64(p.IncrementPrice),
+			FirstHourPrice:   int64(p.FirstHourPrice),
+			Rounding:         p.Rounding,
+			MaxPrice:         int64(p.MaxPrice),
+		}
+	}
+	if rate.Surge != nil {
+		out.Surge = &ratepb.SurgeBounds{Floor: int64(rate.Surge.Floor), Ceiling: int64(rate.Surge.Ceiling)}
+	}
+	return out
+}
+
+func rateFromPB(rate *ratepb.Rate) Rate {
+	out := Rate{
+		ID:          rate.Id,
+		Price:       int(rate.Price),
+		Timezone:    rate.Tz,
+		Times:       rate.Times,
+		Days:        rate.Days,
+		Priority:    int(rate.Priority),
+		Dates:       rate.Dates,
+		MinDuration: rate.MinDuration,
+		MaxDuration: rate.MaxDuration,
+		RateClass:   RateClass{Vehicle: rate.Vehicle, Product: rate.Product},
+	}
+	if p := rate.Pricing; p != nil {
+		out.Pricing = &Pricing{
+			Model:            p.Model,
+			IncrementMinutes: int(p.IncrementMinutes),
+			IncrementPrice:   int(p.IncrementPrice),
+			FirstHourPrice:   int(p.FirstHourPrice),
+			Rounding:         p.Rounding,
+			MaxPrice:         int(p.MaxPrice),
+		}
+	}
+	if rate.Surge != nil {
+		out.Surge = &SurgeBounds{Floor: int(rate.Surge.Floor), Ceiling: int(rate.Surge.Ceiling)}
+	}
+	return out
+}
@@ -1,19 +1,30 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"google.golang.org/grpc"
 )
 
 type RatesController struct {
 	Handler
-	Rates *RateStore
+	Rates RateStore
 }
 
-func NewRatesController(store *RateStore) *RatesController {
+func NewRatesController(store RateStore) *RatesController {
 	controller := RatesController{
 		Handler: Handler{},
 		Rates:   store,
@@ -23,60 +34,371 @@ func NewRatesController(store *RateStore) *RatesController {
 	return &controller
 }
 
-// PostRates - updates the current active rates based on user input.
-// @Summary Updates the current active rates based on user input.
-// @Description Updates the current active rates based on user input.
+// PostRates - replaces the current active rates, or appends a single rate, based on user input.
+// @Summary Replaces the current active rates or appends a single rate.
+// @Description A body of the form {"rates": [...]} replaces the whole rate set, any other body is treated as a single rate to append.
+// @Description Send the ETag from a previous read as If-Match to reject the update if the rates have changed since.
+// @Description With dryRun=true nothing is applied, instead the candidate set is validated and diffed against the current rates.
 // @Tags rates
 // @Accept json
 // @Produce json
 // @Param Rates body Rates true "Update Rates"
+// @Param If-Match header string false "Expected rate set version"
+// @Param dryRun query bool false "Validate and diff without applying"
 // @Success 200 {object} Rates
-// @Failure 400 {object} ErrorResponse
+// @Success 201 {object} Rate
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
 // @Failure 404 ""
-// @Failure 500 {object} ErrorResponse
-// @Router /rates/ [post]
+// @Failure 409 {object} Problem
+// @Failure 412 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /rates [post]
 func (c *RatesController) PostRates(w http.ResponseWriter, r *http.Request) {
-	var rates Rates
 	if r.Body == nil {
-		webError(w, http.StatusBadRequest, ErrMissingBody)
+		webError(w, r, ErrMissingBody, "")
+		return
+	}
+	var raw map[string]json.RawMessage
+	bod, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(bod, &raw)
+	}
+	if err != nil {
+		webError(w, r, ErrBadBody, err.Error())
+		return
+	}
+
+	ifVersion := ifMatchVersion(r)
+	current, version := c.Rates.Snapshot()
+	_, replace := raw["rates"]
+
+	var candidate Rates
+	var rate Rate
+	if replace {
+		err = json.Unmarshal(bod, &candidate)
+	} else {
+		err = json.Unmarshal(bod, &rate)
+		candidate = current
+		candidate.Rates = append(append([]Rate{}, current.Rates...), rate)
 	}
-	err := json.NewDecoder(r.Body).Decode(&rates)
 	if err != nil {
-		webError(w, http.StatusBadRequest, ErrBadBody)
+		webError(w, r, ErrBadBody, err.Error())
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	if dryRun {
+		if ifVersion != AnyVersion && ifVersion != version {
+			storeError(w, r, errVersionMismatch)
+			return
+		}
+		errs := candidate.Validate()
+		out := RatesDryRun{
+			Valid:    len(errs) == 0,
+			Errors:   errs,
+			Version:  version,
+			Diff:     DiffRateSets(current, candidate),
+			Coverage: AnalyzeCoverage(candidate.Rates),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", versionETag(version))
+		json.NewEncoder(w).Encode(out)
+		return
+	}
+
+	errs := candidate.Validate()
+	if len(errs) > 0 {
+		var fields []FieldError
+		for _, v := range errs {
+			pointer := "/"
+			if replace && v.Index >= 0 {
+				pointer = "/rates/" + strconv.Itoa(v.Index)
+			}
+			fields = append(fields, FieldError{pointer, v.Error()})
+		}
+		writeProblem(w, r, ErrInvalidRate, errs[0].Error(), fields)
+		return
+	}
+
+	if !replace {
+		rate, change, err := ratesAs(c.Rates, r).Add(rate, ifVersion)
+		if err != nil {
+			storeError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", "/rates/"+rate.ID)
+		writeRate(w, http.StatusCreated, rate, change.Version)
+		return
+	}
+
+	_, err = ratesAs(c.Rates, r).Set(candidate, ifVersion)
+	if err != nil {
+		storeError(w, r, err)
 		return
 	}
-	c.Rates.Set(rates.Rates)
 	c.GetRates(w, r)
 }
 
+// Result of a dry run update, nothing in it has been applied
+type RatesDryRun struct {
+	Valid    bool                   `json:"valid"`
+	Errors   []*RateValidationError `json:"errors,omitempty"`
+	Version  int                    `json:"version"`
+	Diff     RateDiff               `json:"diff"`
+	Coverage Coverage               `json:"coverage"`
+}
+
 // GetRates - Gets the current active rates.
 // @Summary Gets the current active rates.
 // @Description Gets the current active rates.
 // @Tags rates
 // @Accept json
 // @Produce json
+// @Param If-None-Match header string false "ETag of the rate set the client already has"
 // @Success 200 {object} Rates
-// @Failure 400 {object} ErrorResponse
+// @Success 304 ""
+// @Header 200 {string} ETag "Rate set version and digest"
+// @Failure 400 {object} Problem
 // @Failure 404 ""
-// @Failure 500 {object} ErrorResponse
-// @Router /rates/ [get]
+// @Failure 500 {object} Problem
+// @Router /rates [get]
 func (c *RatesController) GetRates(w http.ResponseWriter, r *http.Request) {
-	rates := c.Rates.Get()
+	set, version := c.Rates.Snapshot()
+	body, err := json.Marshal(set)
+	if err != nil {
+		webError(w, r, ErrInternal, "")
+		return
+	}
 
+	etag := rateSetETag(body, version)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
-	out := Rates{Rates: rates}
-	json.NewEncoder(w).Encode(out)
+	w.Write(append(body, '\n'))
+}
+
+// Serves /rates/{id}
+type RateItemController struct {
+	Handler
+	Rates RateStore
+}
+
+func NewRateItemController(store RateStore) *RateItemController {
+	controller := RateItemController{
+		Handler: Handler{},
+		Rates:   store,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetRateByID)
+	controller.Handler[http.MethodPut] = http.HandlerFunc(controller.PutRate)
+	controller.Handler[http.MethodPatch] = http.HandlerFunc(controller.PatchRate)
+	controller.Handler[http.MethodDelete] = http.HandlerFunc(controller.DeleteRate)
+	return &controller
+}
+
+// GetRateByID - Gets a single rate.
+// @Summary Gets a single rate.
+// @Description Gets a single rate.
+// @Tags rates
+// @Produce json
+// @Param id path string true "Rate ID"
+// @Success 200 {object} Rate
+// @Failure 404 {object} Problem
+// @Router /rates/{id} [get]
+func (c *RateItemController) GetRateByID(w http.ResponseWriter, r *http.Request) {
+	id := rateIDFromPath(r.URL.Path)
+	set, version := c.Rates.Snapshot()
+	i := indexOfRate(set.Rates, id)
+	if id == "" || i < 0 {
+		webError(w, r, ErrNotFound, "")
+		return
+	}
+	writeRate(w, http.StatusOK, set.Rates[i], version)
+}
+
+// PutRate - Replaces a single rate.
+// @Summary Replaces a single rate.
+// @Description Replaces a single rate, the id in the path always wins over the id in the body.
+// @Tags rates
+// @Accept json
+// @Produce json
+// @Param id path string true "Rate ID"
+// @Param Rate body Rate true "Rate"
+// @Param If-Match header string false "Expected rate set version"
+// @Success 200 {object} Rate
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Router /rates/{id} [put]
+func (c *RateItemController) PutRate(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		webError(w, r, ErrMissingBody, "")
+		return
+	}
+	var rate Rate
+	err := json.NewDecoder(r.Body).Decode(&rate)
+	if err != nil {
+		webError(w, r, ErrBadBody, err.Error())
+		return
+	}
+
+	rate, change, err := ratesAs(c.Rates, r).Update(rateIDFromPath(r.URL.Path), ifMatchVersion(r), func(existing *Rate) error {
+		*existing = rate
+		return existing.Validate()
+	})
+	if err != nil {
+		storeError(w, r, err)
+		return
+	}
+	writeRate(w, http.StatusOK, rate, change.Version)
+}
+
+// PatchRate - Partially updates a single rate.
+// @Summary Partially updates a single rate.
+// @Description Applies a JSON merge patch to a single rate, only the fields present in the body are changed.
+// @Tags rates
+// @Accept json
+// @Produce json
+// @Param id path string true "Rate ID"
+// @Param Rate body Rate true "Rate fields to change"
+// @Param If-Match header string false "Expected rate set version"
+// @Success 200 {object} Rate
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Router /rates/{id} [patch]
+func (c *RateItemController) PatchRate(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		webError(w, r, ErrMissingBody, "")
+		return
+	}
+	patch, err := ioutil.ReadAll(r.Body)
+	if err != nil || !json.Valid(patch) {
+		webError(w, r, ErrBadBody, "")
+		return
+	}
+
+	rate, change, err := ratesAs(c.Rates, r).Update(rateIDFromPath(r.URL.Path), ifMatchVersion(r), func(existing *Rate) error {
+		err := json.Unmarshal(patch, existing)
+		if err != nil {
+			return errBadRateJSON
+		}
+		return existing.Validate()
+	})
+	if err != nil {
+		storeError(w, r, err)
+		return
+	}
+	writeRate(w, http.StatusOK, rate, change.Version)
+}
+
+// DeleteRate - Removes a single rate.
+// @Summary Removes a single rate.
+// @Description Removes a single rate.
+// @Tags rates
+// @Param id path string true "Rate ID"
+// @Param If-Match header string false "Expected rate set version"
+// @Success 204 ""
+// @Failure 404 {object} Problem
+// @Failure 412 {object} Problem
+// @Router /rates/{id} [delete]
+func (c *RateItemController) DeleteRate(w http.ResponseWriter, r *http.Request) {
+	change, err := ratesAs(c.Rates, r).Delete(rateIDFromPath(r.URL.Path), ifMatchVersion(r))
+	if err != nil {
+		storeError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", versionETag(change.Version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func rateIDFromPath(path string) string {
+	id := strings.TrimPrefix(path, "/rates/")
+	if strings.Contains(id, "/") {
+		return ""
+	}
+	return id
+}
+
+func writeRate(w http.ResponseWriter, statusCode int, rate Rate, version int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(version))
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(rate)
+}
+
+func versionETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// ETag of the rate set document body at version. The digest tells apart sets that share a version,
+// like those of a leader restarted from its rates file, so followers holding the old set resync.
+func rateSetETag(body []byte, version int) string {
+	sum := sha256.Sum256(body)
+	return strconv.Quote(strconv.Itoa(version) + "-" + hex.EncodeToString(sum[:8]))
+}
+
+// Returns the version of a rate set ETag, with or without its digest
+func etagVersion(etag string) (int, error) {
+	etag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), "\"")
+	if i := strings.IndexByte(etag, '-'); i >= 0 {
+		etag = etag[:i]
+	}
+	return strconv.Atoi(etag)
+}
+
+// Reads the expected store version from If-Match, a missing header or "*" skips the check.
+// An unparsable header never matches so the update is rejected rather than applied blindly.
+func ifMatchVersion(r *http.Request) int {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return AnyVersion
+	}
+	version, err := etagVersion(header)
+	if err != nil || version < 0 {
+		return math.MinInt32
+	}
+	return version
+}
+
+func storeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errAuditWrite) {
+		webError(w, r, ErrInternal, errAuditWrite.Error())
+		return
+	}
+	switch err {
+	case errRateNotFound:
+		webError(w, r, ErrNotFound, "")
+	case errVersionMismatch:
+		webError(w, r, ErrPrecondition, "")
+	case errDuplicateRateID:
+		webError(w, r, ErrConflict, "")
+	case errBadRateJSON:
+		webError(w, r, ErrBadBody, "")
+	case errRateStorage:
+		webError(w, r, ErrInternal, "")
+	default:
+		// validation failures of the changed rate
+		webError(w, r, ErrInvalidRate, err.Error())
+	}
 }
 
 type RateController struct {
 	Handler
-	Rates *RateStore
+	Quoter *Quoter
+	Signer *QuoteSigner
 }
 
-func NewRateController(store *RateStore) *RateController {
+func NewRateController(quoter *Quoter, signer *QuoteSigner) *RateController {
 	controller := RateController{
 		Handler: Handler{},
-		Rates:   store,
+		Quoter:  quoter,
+		Signer:  signer,
 	}
 	controller.Handler[http.MethodPost] = http.HandlerFunc(controller.GetRate)
 
@@ -86,36 +408,51 @@ func NewRateController(store *RateStore) *RateController {
 // GetRate - Given the time range input this returns the rate as int, or "unavailable".
 // @Summary Given the time range input this returns the rate as int, or "unavailable".
 // @Description Given the time range input this returns the rate as int, or "unavailable".
+// @Description With token=true an available rate is returned as {"price": 1750, "token": "..."} instead, see /quote/verify.
 // @Tags rates
 // @Accept json
 // @Produce json
+// @Param RateRequest body RateRequest true "Time range"
+// @Param token query bool false "Also return a signed quote token"
 // @Success 200
-// @Failure 400 {object} ErrorResponse
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
 // @Failure 404 ""
-// @Failure 500 {object} ErrorResponse
+// @Failure 500 {object} Problem
 // @Router /rate [post]
 func (c *RateController) GetRate(w http.ResponseWriter, r *http.Request) {
 	var req RateRequest
 	if r.Body == nil {
-		webError(w, http.StatusBadRequest, ErrMissingBody)
+		webError(w, r, ErrMissingBody, "")
 		return
 	}
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		webError(w, http.StatusBadRequest, ErrBadBody)
+		webError(w, r, ErrBadBody, err.Error())
+		return
+	}
+	err = req.Validate()
+	if err != nil {
+		webError(w, r, ErrInvalidSpan, err.Error())
 		return
 	}
 
-	rates := c.Rates.Get()
-	rate, err := GetRate(rates, req.StartDate.Time, req.EndDate.Time)
+	quote, err := c.Quoter.Quote(req)
 	if err != nil {
-		webError(w, http.StatusInternalServerError, ErrInternal)
+		webError(w, r, ErrRateData, err.Error())
 		return
 	}
 
-	var out interface{} = rate
-	if rate == 0 {
+	var out interface{} = quote.Price
+	if !quote.Available {
 		out = "unavailable"
+	} else if wantsToken(r) {
+		token, err := c.Signer.Sign(quote, time.Now())
+		if err != nil {
+			webError(w, r, ErrInternal, "")
+			return
+		}
+		out = SignedRate{Price: quote.Price, Token: token}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -126,55 +463,298 @@ func (c *RateController) GetRate(w http.ResponseWriter, r *http.Request) {
 // given a start date and time, end date and time, and rates - this returns a valid rate
 // returns 0 if rates is unavailable or input spans multiple rates or days.
 // otherwise returns rate offset ie if rate is $9.25 this returns 925
+// when several rates match the first one wins, see QuoteRate for the other resolution policies
 func GetRate(rates []Rate, start, end time.Time) (int, error) {
-	// does the start / end span multiple days
-	if start.UTC().Year() != end.UTC().Year() || start.UTC().YearDay() != end.UTC().YearDay() {
-		return 0, nil
+	matches, err := MatchRates(rates, start, end)
+	if err != nil || len(matches) == 0 {
+		return 0, err
 	}
+	return rates[matches[0]].PriceFor(end.Sub(start)), nil
+}
+
+// Returns the indexes of every rate the start / end span fits within, in slice order.
+// When any date override matches only the matching date overrides are returned.
+func MatchRates(rates []Rate, start, end time.Time) ([]int, error) {
+	matches, _, err := matchRates(rates, start, end, RateClass{})
+	return matches, err
+}
+
+// Reasons a span can't be priced
+const (
+	ReasonMultipleDays = "spans-multiple-days"
+	ReasonNoRate       = "no-rate-covers-span"
+	ReasonTooShort     = "shorter-than-min-duration"
+	ReasonTooLong      = "longer-than-max-duration"
+)
+
+// A rate whose window covers a span but whose stay limits reject it
+type RateRejection struct {
+	RateID string `json:"rateId"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
 
-	for _, v := range rates {
+// Like MatchRates for the given class, also returns the rates that only failed on their stay limits.
+// After date overrides, rates specific to the class take precedence over default rates.
+func matchRates(rates []Rate, start, end time.Time, class RateClass) ([]int, []RateRejection, error) {
+	var matches []int
+	var rejections []RateRejection
+	for i, v := range rates {
+		if !v.RateClass.Serves(class) {
+			continue
+		}
 		rateLocation, err := time.LoadLocation(v.Timezone)
 		if err != nil {
-			return 0, err
+			return nil, nil, err
 		}
-		startDay := int(start.In(rateLocation).Weekday())
 
 		rateStartOffset, rateEndOffset, err := v.GetTimes()
 		if err != nil {
-			return 0, err
+			return nil, nil, err
 		}
 
-		// calculate rate starts based on input start/end dates to account for historical timezone offsets and daylight savings
-		rateStart := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
-		rateStart = rateStart.In(rateLocation).Add(rateStartOffset)
+		// match days and times in the rate's zone whatever offset the span was sent with
+		localStart, localEnd := start.In(rateLocation), end.In(rateLocation)
+
+		// does the start / end span multiple days
+		if localStart.Year() != localEnd.Year() || localStart.YearDay() != localEnd.YearDay() {
+			continue
+		}
 
-		rateEnd := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, end.Location())
-		rateEnd = rateEnd.In(rateLocation).Add(rateEndOffset)
+		// calculate rate starts from the local day to account for historical timezone offsets and daylight savings
+		day := time.Date(localStart.Year(), localStart.Month(), localStart.Day(), 0, 0, 0, 0, rateLocation)
+		rateStart := day.Add(rateStartOffset)
+		rateEnd := day.Add(rateEndOffset)
 
 		// is input within rate range and day?
-		if (start.After(rateStart) || start.Equal(rateStart)) && (end.Before(rateEnd) || end.Equal(rateEnd)) && IntContains(v.GetDays(), startDay) {
-			return v.Price, nil
+		if !(start.After(rateStart) || start.Equal(rateStart)) || !(end.Before(rateEnd) || end.Equal(rateEnd)) {
+			continue
+		}
+		applies, err := v.AppliesOn(localStart)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !applies {
+			continue
+		}
+
+		// does the stay fit the rate's limits?
+		min, max, err := v.GetStayLimits()
+		if err != nil {
+			return nil, nil, err
+		}
+		duration := end.Sub(start)
+		switch {
+		case duration < min:
+			rejections = append(rejections, RateRejection{RateID: rateLabel(rates, i), Reason: ReasonTooShort, Detail: "minimum stay is " + min.String()})
+		case max > 0 && duration > max:
+			rejections = append(rejections, RateRejection{RateID: rateLabel(rates, i), Reason: ReasonTooLong, Detail: "maximum stay is " + max.String()})
+		default:
+			matches = append(matches, i)
 		}
 	}
 
-	// rate not found
-	return 0, nil
+	return preferClassSpecific(rates, preferDateOverrides(rates, matches)), rejections, nil
+}
+
+// Optional server dependencies, anything left unset is disabled
+type serverOptions struct {
+	auditLog     *AuditLog
+	promos       *PromoStore
+	surge        *SurgeStore
+	reservations *ReservationStore
+	signer       *QuoteSigner
+	sync         *RateSync
+	webhooks     *WebhookNotifier
+	adminToken   string
 }
 
-func NewServer(rateStore *RateStore, metricsStore *MetricsStore) *http.ServeMux {
+type ServerOption func(*serverOptions)
+
+func WithAuditLog(log *AuditLog) ServerOption {
+	return func(o *serverOptions) {
+		o.auditLog = log
+	}
+}
+
+func WithPromos(store *PromoStore) ServerOption {
+	return func(o *serverOptions) {
+		o.promos = store
+	}
+}
+
+func WithSurge(store *SurgeStore) ServerOption {
+	return func(o *serverOptions) {
+		o.surge = store
+	}
+}
+
+func WithReservations(store *ReservationStore) ServerOption {
+	return func(o *serverOptions) {
+		o.reservations = store
+	}
+}
+
+func WithQuoteSigner(signer *QuoteSigner) ServerOption {
+	return func(o *serverOptions) {
+		o.signer = signer
+	}
+}
+
+// Runs the server as a follower whose rates are kept in sync with a leader
+func WithRateSync(sync *RateSync) ServerOption {
+	return func(o *serverOptions) {
+		o.sync = sync
+	}
+}
+
+func WithWebhooks(notifier *WebhookNotifier) ServerOption {
+	return func(o *serverOptions) {
+		o.webhooks = notifier
+	}
+}
+
+// Requires "Authorization: Bearer <token>" on admin endpoints, without a token they are refused
+func WithAdminToken(token string) ServerOption {
+	return func(o *serverOptions) {
+		o.adminToken = token
+	}
+}
+
+// The stores and pricing shared by the http and grpc apis
+type services struct {
+	serverOptions
+	rates       RateStore
+	quoter      *Quoter
+	broadcaster *RateBroadcaster
+}
+
+func newServices(rateStore RateStore, opts ...ServerOption) *services {
+	options := serverOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.promos == nil {
+		options.promos = NewPromoStore()
+	}
+	if options.surge == nil {
+		options.surge = NewSurgeStore()
+	}
+	if options.reservations == nil {
+		options.reservations = NewReservationStore(0)
+	}
+	if options.signer == nil {
+		options.signer = NewEphemeralQuoteSigner(defaultQuoteTTL)
+	}
+	broadcaster := NewRateBroadcaster()
+	listeners := []func(RateSetChange){broadcaster.Publish}
+	if options.webhooks != nil {
+		listeners = append(listeners, options.webhooks.Notify)
+	}
+	if options.sync != nil {
+		options.sync.OnChange = broadcaster.Publish
+	}
+	rateStore = &notifyingRateStore{RateStore: rateStore, audit: options.auditLog, listeners: listeners}
+
+	return &services{
+		serverOptions: options,
+		rates:         rateStore,
+		quoter:        NewQuoter(rateStore, options.promos, options.surge),
+		broadcaster:   broadcaster,
+	}
+}
+
+func NewServer(rateStore RateStore, metricsStore *MetricsStore, opts ...ServerOption) *http.ServeMux {
+	return newServices(rateStore, opts...).httpHandler(metricsStore)
+}
+
+// Builds the http and grpc servers over the same stores, so changes made through either reach both
+func NewServers(rateStore RateStore, metricsStore *MetricsStore, opts ...ServerOption) (*http.ServeMux, *grpc.Server) {
+	s := newServices(rateStore, opts...)
+	return s.httpHandler(metricsStore), s.grpcServer(metricsStore)
+}
+
+// A path on the http mux, the methods it answers are the keys of controller
+type route struct {
+	pattern    string
+	controller Handler
+	middleware []Middleware
+}
+
+func (s *services) httpHandler(metricsStore *MetricsStore) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, v := range s.httpRoutes(metricsStore) {
+		mux.Handle(v.pattern, MiddlewareChain(v.controller, v.middleware...))
+	}
+	// anything else is answered with a not-found problem, an empty Handler serves no methods
+	mux.Handle("/", MiddlewareChain(Handler{}, NewRequestIDMiddleware()))
+	return mux
+}
+
+func (s *services) httpRoutes(metricsStore *MetricsStore) []route {
+	options, rateStore, quoter, broadcaster := s.serverOptions, s.rates, s.quoter, s.broadcaster
+
+	requestIDMiddleware := NewRequestIDMiddleware()
 	metricsMiddleware := NewMetricsMiddleware(metricsStore)
 	panicMiddleware := NewRecoveryMiddleware()
+	principalMiddleware := NewPrincipalMiddleware(options.adminToken)
+	adminMiddleware := NewAdminAuthMiddleware(options.adminToken, true)
+	adminWritesMiddleware := NewAdminAuthMiddleware(options.adminToken, false)
+	replicaMiddleware := NewReadOnlyReplicaMiddleware(options.sync != nil)
 	ratesController := NewRatesController(rateStore)
-	rateController := NewRateController(rateStore)
+	rateItemController := NewRateItemController(rateStore)
+	auditController := NewAuditController(options.auditLog)
+	coverageController := NewCoverageController(rateStore)
+	rateStreamController := NewRateStreamController(rateStore, broadcaster)
+	rateController := NewRateController(quoter, options.signer)
+	quoteController := NewQuoteController(quoter, options.signer)
+	quoteVerifyController := NewQuoteVerifyController(options.signer, rateStore)
+	promosController := NewPromosController(options.promos)
+	promoItemController := NewPromoItemController(options.promos)
+	surgeController := NewSurgeController(options.surge)
+	reservationsController := NewReservationsController(quoter, options.reservations)
+	reservationItemController := NewReservationItemController(options.reservations, options.promos)
 	metricsController := NewMetricsController(metricsStore)
+	readyController := NewReadyController(rateStore, options.sync)
+	openAPIController := NewOpenAPIController()
+	docsController := NewDocsController()
+	graphqlController, err := NewGraphQLController(s)
+	if err != nil {
+		// the schema is static, this only fails when it is invalid
+		panic(err)
+	}
+	validationMiddleware, err := NewValidationMiddleware(openAPISpec)
+	if err != nil {
+		// the spec is embedded, TestOpenAPIRoutes catches a broken one
+		panic(err)
+	}
 
-	mux := http.NewServeMux()
-
-	mux.Handle("/rates", MiddlewareChain(ratesController, panicMiddleware, metricsMiddleware))
-	mux.Handle("/rate", MiddlewareChain(rateController, panicMiddleware, metricsMiddleware))
-	mux.Handle("/metrics", panicMiddleware(metricsController))
+	// requests are validated after the admin and replica checks so those answer first
+	with := func(m ...Middleware) []Middleware {
+		return append(append([]Middleware{requestIDMiddleware, panicMiddleware, metricsMiddleware, principalMiddleware}, m...), validationMiddleware)
+	}
+	api := with()
 
-	return mux
+	return []route{
+		{"/rates", ratesController.Handler, with(replicaMiddleware)},
+		{"/rates/", rateItemController.Handler, with(replicaMiddleware)},
+		{"/rates/audit", auditController.Handler, api},
+		{"/rates/stream", rateStreamController.Handler, api},
+		{"/rates/coverage", coverageController.Handler, api},
+		{"/rate", rateController.Handler, api},
+		{"/quote", quoteController.Handler, api},
+		{"/promos", promosController.Handler, with(adminMiddleware)},
+		{"/promos/", promoItemController.Handler, with(adminMiddleware)},
+		{"/quote/verify", quoteVerifyController.Handler, api},
+		{"/reservations", reservationsController.Handler, api},
+		{"/reservations/", reservationItemController.Handler, api},
+		{"/surge", surgeController.Handler, with(adminWritesMiddleware)},
+		{"/graphql", graphqlController.Handler, api},
+		{"/metrics", metricsController.Handler, []Middleware{panicMiddleware}},
+		{"/ready", readyController.Handler, []Middleware{panicMiddleware}},
+		{"/openapi.json", openAPIController.Handler, []Middleware{panicMiddleware}},
+		{"/docs", docsController.Handler, []Middleware{panicMiddleware}},
+	}
 }
 
 // @title Rate API
@@ -187,25 +767,162 @@ func NewServer(rateStore *RateStore, metricsStore *MetricsStore) *http.ServeMux
 // @license.url http://www.apache.org/licenses/LICENSE-2.0.html
 // @BasePath /
 func main() {
-	path := os.Getenv("RATE_API_RATES_PATH")
-	if path == "" || path == "." {
-		path = "./rates.json"
+	if len(os.Args) > 1 {
+		err := runCommand(os.Args[1], os.Args[2:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
+
+	path := ratesPath()
 	portStr := os.Getenv("RATE_API_PORT")
 	if len(portStr) < 1 {
 		portStr = "3000"
 	}
-	rateStore, err := RateStoreFromFile(path)
+	auditPath := os.Getenv("RATE_API_AUDIT_PATH")
+	if auditPath == "" {
+		auditPath = "./audit.jsonl"
+	}
+	rateStore, closeRates, err := OpenRateStore(os.Getenv("RATE_API_STORE"), os.Getenv("RATE_API_STORE_PATH"), path)
 	if err != nil {
 		panic(err)
 	}
+	defer closeRates()
+	auditLog, err := NewAuditLog(auditPath)
+	if err != nil {
+		panic(err)
+	}
+	defer auditLog.Close()
+	promoStore := NewPromoStore()
+	promosPath := os.Getenv("RATE_API_PROMOS_PATH")
+	if promosPath != "" {
+		promoStore, err = PromoStoreFromFile(promosPath)
+		if err != nil {
+			panic(err)
+		}
+	}
+	surgeStore := NewSurgeStore()
+	surgePath := os.Getenv("RATE_API_SURGE_PATH")
+	if surgePath != "" {
+		err = surgeStore.Load(surgePath)
+		if err != nil {
+			panic(err)
+		}
+		stopSurge := make(chan struct{})
+		defer close(stopSurge)
+		go surgeStore.Watch(surgePath, 10*time.Second, stopSurge)
+	}
+	capacity := 0
+	if capacityStr := os.Getenv("RATE_API_CAPACITY"); capacityStr != "" {
+		capacity, err = strconv.Atoi(capacityStr)
+		if err != nil || capacity < 0 {
+			panic(fmt.Errorf("invalid RATE_API_CAPACITY %q", capacityStr))
+		}
+	}
+	reservationStore := NewReservationStore(capacity)
+	reservationsPath := os.Getenv("RATE_API_RESERVATIONS_PATH")
+	if reservationsPath != "" {
+		reservationStore, err = ReservationStoreFromFile(reservationsPath, capacity)
+		if err != nil {
+			panic(err)
+		}
+	}
+	quoteTTL := defaultQuoteTTL
+	if ttlStr := os.Getenv("RATE_API_QUOTE_TTL"); ttlStr != "" {
+		quoteTTL, err = time.ParseDuration(ttlStr)
+		if err != nil || quoteTTL <= 0 {
+			panic(fmt.Errorf("invalid RATE_API_QUOTE_TTL %q", ttlStr))
+		}
+	}
+	signer := NewEphemeralQuoteSigner(quoteTTL)
+	if key := os.Getenv("RATE_API_QUOTE_KEY"); key != "" {
+		signer = NewQuoteSigner([]byte(key), quoteTTL)
+	} else {
+		log.Println("RATE_API_QUOTE_KEY is not set, quote tokens can only be verified by this instance")
+	}
+	adminToken := os.Getenv("RATE_API_ADMIN_TOKEN")
+	if adminToken == "" {
+		log.Println("RATE_API_ADMIN_TOKEN is not set, admin endpoints will refuse every request")
+	}
+	var rateSync *RateSync
+	if leader := os.Getenv("RATE_API_LEADER_URL"); leader != "" {
+		interval := 5 * time.Second
+		if intervalStr := os.Getenv("RATE_API_SYNC_INTERVAL"); intervalStr != "" {
+			interval, err = time.ParseDuration(intervalStr)
+			if err != nil || interval <= 0 {
+				panic(fmt.Errorf("invalid RATE_API_SYNC_INTERVAL %q", intervalStr))
+			}
+		}
+		rateSync = NewRateSync(rateStore, leader, interval)
+	}
+	var webhooks *WebhookNotifier
+	if webhooksPath := os.Getenv("RATE_API_WEBHOOKS_PATH"); webhooksPath != "" {
+		deadLetterPath := os.Getenv("RATE_API_WEBHOOK_DEAD_LETTER_PATH")
+		if deadLetterPath == "" {
+			deadLetterPath = "./webhooks-dead.jsonl"
+		}
+		webhooks, err = WebhookNotifierFromFile(webhooksPath, deadLetterPath)
+		if err != nil {
+			panic(err)
+		}
+		defer webhooks.Close()
+	}
+	grpcPort := os.Getenv("RATE_API_GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "3001"
+	}
 	metricsStore := NewMetricsStore()
-	mux := NewServer(rateStore, metricsStore)
+	mux, grpcServer := NewServers(rateStore, metricsStore,
+		WithAuditLog(auditLog),
+		WithPromos(promoStore),
+		WithSurge(surgeStore),
+		WithReservations(reservationStore),
+		WithQuoteSigner(signer),
+		WithRateSync(rateSync),
+		WithWebhooks(webhooks),
+		WithAdminToken(adminToken),
+	)
+	if rateSync != nil {
+		// started once the server has hooked into its changes
+		stopSync := make(chan struct{})
+		defer close(stopSync)
+		go rateSync.Run(stopSync)
+	}
+	grpcListener, err := net.Listen("tcp", ":"+grpcPort)
+	if err != nil {
+		panic(err)
+	}
+	log.Println("Serving grpc on :" + grpcPort)
+	go grpcServer.Serve(grpcListener)
+	defer grpcServer.Stop()
+
 	addr := ":" + portStr
 	log.Println("Listening on " + addr)
 	http.ListenAndServe(addr, mux)
 }
 
+// Offline tooling, invoked as rate-api <command> [flags]
+func runCommand(name string, args []string) error {
+	switch name {
+	case "simulate":
+		return runSimulate(args, os.Stdout)
+	case "coverage":
+		return runCoverage(args, os.Stdout)
+	default:
+		return fmt.Errorf("unknown command %q, expected one of: simulate, coverage", name)
+	}
+}
+
+func ratesPath() string {
+	path := os.Getenv("RATE_API_RATES_PATH")
+	if path == "" || path == "." {
+		path = "./rates.json"
+	}
+	return path
+}
+
 type MetricsController struct {
 	Handler
 	store *MetricsStore
@@ -228,9 +945,9 @@ func NewMetricsController(store *MetricsStore) *MetricsController {
 // @Accept json
 // @Produce json
 // @Success 200 {object} EndpointMetrics
-// @Failure 400 {object} ErrorResponse
+// @Failure 400 {object} Problem
 // @Failure 404 ""
-// @Failure 500 {object} ErrorResponse
+// @Failure 500 {object} Problem
 // @Router /metrics [get]
 func (c *MetricsController) GetMetrics(w http.ResponseWriter, r *http.Request) {
 	metrics := c.store.Get()
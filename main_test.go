@@ -1,14 +1,34 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/Ashtonian/rate-api/rpc/ratepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type ComputePriceCase struct {
@@ -96,8 +116,8 @@ func TestComputePrice(t *testing.T) {
 		},
 		ComputePriceCase{
 			Request: RateRequest{
-				StartDate: ISO8601Time{time.Date(2015, 7, 2, 1, 45, 0, 0, chicago)},
-				EndDate:   ISO8601Time{time.Date(2015, 7, 2, 6, 50, 0, 0, chicago)},
+				StartDate: ISO8601Time{time.Date(2015, 7, 2, 0, 45, 0, 0, chicago)},
+				EndDate:   ISO8601Time{time.Date(2015, 7, 2, 6, 20, 0, 0, chicago)},
 			},
 			Expected:    985,
 			Description: "Test Minutes valid",
@@ -184,7 +204,7 @@ func TestRatesEndpoint(t *testing.T) {
 			Price:    1750,
 		},
 	}
-	store := &RateStore{
+	store := &MemoryRateStore{
 		rates: rates,
 	}
 	metricsStore := NewMetricsStore()
@@ -208,6 +228,7 @@ func TestRatesEndpoint(t *testing.T) {
 		rates := Rates{
 			Rates: []Rate{
 				Rate{
+					ID:       "wed-early",
 					Days:     "wed",
 					Times:    "0600-1800",
 					Timezone: "America/Chicago",
@@ -234,8 +255,82 @@ func TestRatesEndpoint(t *testing.T) {
 	})
 }
 
+func TestRateItemEndpoints(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: []Rate{
+		Rate{
+			ID:       "wed",
+			Days:     "wed",
+			Times:    "0600-1800",
+			Timezone: "America/Chicago",
+			Price:    1750,
+		},
+	}}, AnyVersion)
+	server := NewServer(store, NewMetricsStore())
+
+	t.Run("Append Rate", func(t *testing.T) {
+		bod := `{"days":"fri","times":"0900-2100","tz":"America/Chicago","price":2000}`
+		request, _ := http.NewRequest(http.MethodPost, "/rates", strings.NewReader(bod))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertEqual(t, "Status Code", http.StatusCreated, response.Result().StatusCode)
+		assertEqual(t, "ETag", `"2"`, response.Header().Get("ETag"))
+		var rate Rate
+		json.Unmarshal(response.Body.Bytes(), &rate)
+		assertEqual(t, "Location", "/rates/"+rate.ID, response.Header().Get("Location"))
+		assertEqual(t, "Rate Count", 2, len(store.Get()))
+	})
+
+	t.Run("Get Rate", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/rates/wed", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertEqual(t, "Status Code", http.StatusOK, response.Result().StatusCode)
+		var rate Rate
+		json.Unmarshal(response.Body.Bytes(), &rate)
+		assertEqual(t, "Price", 1750, rate.Price)
+	})
+
+	t.Run("Patch Rate", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPatch, "/rates/wed", strings.NewReader(`{"price":1800}`))
+		request.Header.Set("If-Match", `"2"`)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertEqual(t, "Status Code", http.StatusOK, response.Result().StatusCode)
+		rate, _ := store.Find("wed")
+		assertEqual(t, "Price", 1800, rate.Price)
+		assertEqual(t, "Times", "0600-1800", rate.Times)
+	})
+
+	t.Run("Stale If-Match", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodPut, "/rates/wed", strings.NewReader(`{"days":"wed","times":"0600-1800","tz":"America/Chicago","price":1}`))
+		request.Header.Set("If-Match", `"2"`)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+
+		assertEqual(t, "Status Code", http.StatusPreconditionFailed, response.Result().StatusCode)
+		rate, _ := store.Find("wed")
+		assertEqual(t, "Price", 1800, rate.Price)
+	})
+
+	t.Run("Delete Rate", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodDelete, "/rates/wed", nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertEqual(t, "Status Code", http.StatusNoContent, response.Result().StatusCode)
+
+		request, _ = http.NewRequest(http.MethodGet, "/rates/wed", nil)
+		response = httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertEqual(t, "Status Code", http.StatusNotFound, response.Result().StatusCode)
+	})
+}
+
 func TestPriceEndpoint(t *testing.T) {
-	store := &RateStore{
+	store := &MemoryRateStore{
 		rates: []Rate{
 			Rate{
 				Days:     "wed",
@@ -290,7 +385,7 @@ func TestPriceEndpoint(t *testing.T) {
 }
 
 func TestMetricsEndpoint(t *testing.T) {
-	store := &RateStore{
+	store := &MemoryRateStore{
 		rates: []Rate{
 			Rate{
 				Days:     "mon,tues,thurs",
@@ -321,30 +416,35 @@ func TestMetricsEndpoint(t *testing.T) {
 
 var defaultRates = []Rate{
 	Rate{
+		ID:       "b7c6d2f1a0e94c31",
 		Days:     "mon,tues,thurs",
 		Times:    "0900-2100",
 		Timezone: "America/Chicago",
 		Price:    1500,
 	},
 	Rate{
+		ID:       "4e1f8a2d9c3b6a70",
 		Days:     "fri,sat,sun",
 		Times:    "0900-2100",
 		Timezone: "America/Chicago",
 		Price:    2000,
 	},
 	Rate{
+		ID:       "9d2a5c7e1b4f8036",
 		Days:     "wed",
 		Times:    "0600-1800",
 		Timezone: "America/Chicago",
 		Price:    1750,
 	},
 	Rate{
+		ID:       "1c8e3f6a2d9b5704",
 		Days:     "mon,wed,sat",
 		Times:    "0100-0500",
 		Timezone: "America/Chicago",
 		Price:    1000,
 	},
 	Rate{
+		ID:       "6f0b9e4d3a7c2158",
 		Days:     "sun,tues",
 		Times:    "0100-0700",
 		Timezone: "America/Chicago",
@@ -417,3 +517,1358 @@ func TestMetricsRecord(t *testing.T) {
 
 	assertEqual(t, "Metrics Record Results", fmt.Sprintf("%v", expected), fmt.Sprintf("%v", metrics.Metrics))
 }
+
+func TestRatesDryRun(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore())
+
+	candidate := Rates{
+		Rates: []Rate{
+			defaultRates[0],
+			Rate{
+				ID:       defaultRates[1].ID,
+				Days:     "fri,sat,sun",
+				Times:    "0900-2100",
+				Timezone: "America/Chicago",
+				Price:    2500,
+			},
+			Rate{
+				Days:     "wed",
+				Times:    "0000-2400",
+				Timezone: "America/Chicago",
+				Price:    3000,
+			},
+		},
+	}
+	bod, _ := json.Marshal(candidate)
+	request, _ := http.NewRequest(http.MethodPost, "/rates?dryRun=true", bytes.NewBuffer(bod))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	assertEqual(t, "Status Code", http.StatusOK, response.Result().StatusCode)
+	var out RatesDryRun
+	json.Unmarshal(response.Body.Bytes(), &out)
+	assertEqual(t, "Valid", true, out.Valid)
+	assertEqual(t, "Added", 1, len(out.Diff.Added))
+	assertEqual(t, "Removed", 3, len(out.Diff.Removed))
+	assertEqual(t, "Changed", 1, len(out.Diff.Changed))
+	assertEqual(t, "Changed Price", 2500, out.Diff.Changed[0].After.Price)
+	assertEqual(t, "Store Untouched", 1, store.Version())
+
+	request, _ = http.NewRequest(http.MethodPost, "/rates?dryRun=true", strings.NewReader(`{"rates":[{"days":"someday","times":"0900-2100","tz":"America/Chicago","price":1}]}`))
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	json.Unmarshal(response.Body.Bytes(), &out)
+	assertEqual(t, "Invalid", false, out.Valid)
+
+	request, _ = http.NewRequest(http.MethodPost, "/rates", strings.NewReader(`{"rates":[{"days":"wed","times":"2100-0900","tz":"America/Chicago","price":1}]}`))
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "Invalid Update Status Code", http.StatusUnprocessableEntity, response.Result().StatusCode)
+}
+
+func TestAnalyzeCoverage(t *testing.T) {
+	coverage := AnalyzeCoverage([]Rate{
+		Rate{ID: "a", Days: "mon", Times: "0000-1200", Timezone: "America/Chicago"},
+		Rate{ID: "b", Days: "mon", Times: "1000-2000", Timezone: "America/Chicago"},
+	})
+
+	assertEqual(t, "Overlaps", fmt.Sprintf("%v", []CoverageInterval{
+		CoverageInterval{Day: "mon", Times: "1000-1200", Timezone: "America/Chicago", RateIDs: []string{"a", "b"}},
+	}), fmt.Sprintf("%v", coverage.Overlaps))
+	assertEqual(t, "Gap Count", 7, len(coverage.Gaps))
+	assertEqual(t, "Monday Gap", "2000-2400", coverage.Gaps[1].Times)
+}
+
+func TestSimulate(t *testing.T) {
+	requests, err := ReadRateRequests(strings.NewReader(`
+{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T12:00:00-05:00"}
+{"startDate":"2015-07-04T15:00:00+00:00","endDate":"2015-07-04T20:00:00+00:00"}
+{"startDate":"2015-07-02T01:00:00-05:00","endDate":"2015-07-02T02:00:00-05:00"}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidate := []Rate{
+		Rate{Days: "wed", Times: "0600-1800", Timezone: "America/Chicago", Price: 2000},
+		Rate{Days: "fri,sat,sun", Times: "0900-2100", Timezone: "America/Chicago", Price: 2000},
+		Rate{Days: "thurs", Times: "0000-0300", Timezone: "America/Chicago", Price: 500},
+	}
+
+	report, err := Simulate(Rates{Rates: defaultRates}, Rates{Rates: candidate, Policy: PolicyLowestPrice}, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "Requests", 3, report.Requests)
+	assertEqual(t, "Changed", 2, report.Changed)
+	assertEqual(t, "Newly Available", 1, report.NewlyAvailable)
+	assertEqual(t, "Current Revenue", 3750, report.CurrentRevenue)
+	assertEqual(t, "Revenue Delta", 750, report.RevenueDelta)
+}
+
+func TestAuditLog(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "rate-api")
+	defer os.RemoveAll(dir)
+	auditLog, err := NewAuditLog(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore(), WithAuditLog(auditLog), WithAdminToken("secret"))
+
+	request, _ := http.NewRequest(http.MethodPatch, "/rates/"+defaultRates[0].ID, strings.NewReader(`{"price":1600}`))
+	request.Header.Set("Authorization", "Bearer secret")
+	request.Header.Set("X-Actor", "ops@example.com")
+	request.Header.Set("X-Request-ID", "req-1")
+	server.ServeHTTP(httptest.NewRecorder(), request)
+
+	// rate routes are open, a wrong token isn't refused but isn't credited either
+	request, _ = http.NewRequest(http.MethodDelete, "/rates/"+defaultRates[1].ID, nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	server.ServeHTTP(httptest.NewRecorder(), request)
+
+	request, _ = http.NewRequest(http.MethodGet, "/rates/audit?offset=1&limit=5", nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	assertEqual(t, "Status Code", http.StatusOK, response.Result().StatusCode)
+	var page AuditPage
+	json.Unmarshal(response.Body.Bytes(), &page)
+	assertEqual(t, "Total", 2, page.Total)
+	assertEqual(t, "Page Size", 1, len(page.Entries))
+	assertEqual(t, "Actor", anonymousPrincipal, page.Entries[0].Actor)
+	assertEqual(t, "Claimed Actor", "", page.Entries[0].ClaimedActor)
+	assertEqual(t, "Version", 3, page.Entries[0].Version)
+	assertEqual(t, "Removed", defaultRates[1].ID, page.Entries[0].Diff.Removed[0].ID)
+
+	first, _ := auditLog.List(0, 1)
+	assertEqual(t, "First Actor", adminPrincipal, first.Entries[0].Actor)
+	assertEqual(t, "First Claimed Actor", "ops@example.com", first.Entries[0].ClaimedActor)
+	assertEqual(t, "First Request ID", "req-1", first.Entries[0].RequestID)
+	assertEqual(t, "First Change", 1600, first.Entries[0].Diff.Changed[0].After.Price)
+
+	// the change stays applied but the request fails when it can't be audited
+	auditLog.file.Close()
+	request, _ = http.NewRequest(http.MethodDelete, "/rates/"+defaultRates[2].ID, nil)
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "Unaudited Status Code", http.StatusInternalServerError, response.Result().StatusCode)
+	assertEqual(t, "Unaudited Version", 4, store.Version())
+}
+
+func TestCoverageReport(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore())
+
+	request, _ := http.NewRequest(http.MethodGet, "/rates/coverage?year=2015", nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	assertEqual(t, "Status Code", http.StatusOK, response.Result().StatusCode)
+	var report CoverageReport
+	json.Unmarshal(response.Body.Bytes(), &report)
+	assertEqual(t, "Overlaps", 0, len(report.Overlaps))
+	assertEqual(t, "Transitions", 2, len(report.DSTTransitions))
+
+	springForward := report.DSTTransitions[0]
+	assertEqual(t, "Spring Forward Date", "2015-03-08", springForward.Date)
+	assertEqual(t, "Spring Forward Gaps", fmt.Sprintf("%v", []CoverageInterval{
+		CoverageInterval{Day: "sun", Times: "0000-0100", Timezone: "America/Chicago"},
+		CoverageInterval{Day: "sun", Times: "0800-1000", Timezone: "America/Chicago"},
+		CoverageInterval{Day: "sun", Times: "2200-2400", Timezone: "America/Chicago"},
+	}), fmt.Sprintf("%v", springForward.Gaps))
+}
+
+func TestQuotePolicies(t *testing.T) {
+	rates := []Rate{
+		Rate{ID: "a", Days: "mon", Times: "0100-0500", Timezone: "America/Chicago", Price: 1000},
+		Rate{ID: "b", Days: "mon", Times: "0000-1200", Timezone: "America/Chicago", Price: 500, Priority: 5},
+		Rate{ID: "c", Days: "mon", Times: "0200-0400", Timezone: "America/Chicago", Price: 2000, Priority: 1},
+	}
+	chicago, _ := time.LoadLocation("America/Chicago")
+	start := time.Date(2015, 7, 6, 2, 0, 0, 0, chicago)
+	end := time.Date(2015, 7, 6, 3, 0, 0, 0, chicago)
+
+	cases := map[string]string{
+		"":                 "a",
+		PolicyFirstMatch:   "a",
+		PolicyLowestPrice:  "b",
+		PolicyHighestPrice: "c",
+		PolicyPriority:     "b",
+	}
+	for policy, expected := range cases {
+		quote, err := QuoteRate(Rates{Rates: rates, Policy: policy}, RateRequest{StartDate: ISO8601Time{start}, EndDate: ISO8601Time{end}})
+		if err != nil {
+			t.Error(err)
+		}
+		assertEqual(t, "Winner for "+policy, expected, quote.RateID)
+		assertEqual(t, "Matches for "+policy, 3, len(quote.MatchedRateIDs))
+	}
+
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: rates, Policy: PolicyHighestPrice}, AnyVersion)
+	server := NewServer(store, NewMetricsStore())
+	bod, _ := json.Marshal(RateRequest{StartDate: ISO8601Time{start}, EndDate: ISO8601Time{end}})
+	request, _ := http.NewRequest(http.MethodPost, "/quote", bytes.NewBuffer(bod))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	assertEqual(t, "Status Code", http.StatusOK, response.Result().StatusCode)
+	var quote Quote
+	json.Unmarshal(response.Body.Bytes(), &quote)
+	assertEqual(t, "Quote Price", 2000, quote.Price)
+	assertEqual(t, "Quote Policy", PolicyHighestPrice, quote.Policy)
+	assertEqual(t, "Quote Version", 1, quote.Version)
+
+	request, _ = http.NewRequest(http.MethodPost, "/rates", strings.NewReader(`{"rates":[],"policy":"cheapest"}`))
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "Invalid Policy Status Code", http.StatusUnprocessableEntity, response.Result().StatusCode)
+}
+
+func TestPricingModels(t *testing.T) {
+	perHour := Rate{Price: 100, Pricing: &Pricing{Model: PricingPerIncrement, IncrementPrice: 300, MaxPrice: 1000}}
+	perQuarter := Rate{Pricing: &Pricing{Model: PricingPerIncrement, IncrementMinutes: 15, IncrementPrice: 100, Rounding: RoundNearest}}
+	firstHour := Rate{Pricing: &Pricing{Model: PricingFirstHour, FirstHourPrice: 500, IncrementMinutes: 30, IncrementPrice: 200, Rounding: RoundDown}}
+
+	assertEqual(t, "Flat", 1500, defaultRates[0].PriceFor(3*time.Hour))
+	assertEqual(t, "Per Hour Minimum", 300, perHour.PriceFor(0))
+	assertEqual(t, "Per Hour Rounds Up", 600, perHour.PriceFor(61*time.Minute))
+	assertEqual(t, "Per Hour Max", 1000, perHour.PriceFor(5*time.Hour))
+	assertEqual(t, "Per Quarter Nearest", 300, perQuarter.PriceFor(52*time.Minute))
+	assertEqual(t, "First Hour Only", 500, firstHour.PriceFor(40*time.Minute))
+	assertEqual(t, "First Hour Plus Additional", 900, firstHour.PriceFor(2*time.Hour+10*time.Minute))
+	assertEqual(t, "First Hour Rounds Down", 500, firstHour.PriceFor(time.Hour+20*time.Minute))
+
+	chicago, _ := time.LoadLocation("America/Chicago")
+	rates := []Rate{
+		Rate{ID: "hourly", Days: "wed", Times: "0600-1800", Timezone: "America/Chicago", Pricing: perHour.Pricing},
+		Rate{ID: "flat", Days: "wed", Times: "0600-1800", Timezone: "America/Chicago", Price: 700},
+	}
+	quote, err := QuoteRate(Rates{Rates: rates, Policy: PolicyLowestPrice}, RateRequest{StartDate: ISO8601Time{time.Date(2015, 7, 1, 7, 0, 0, 0, chicago)}, EndDate: ISO8601Time{time.Date(2015, 7, 1, 8, 30, 0, 0, chicago)}})
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(t, "Lowest Computed Price", 600, quote.Price)
+	assertEqual(t, "Lowest Computed Rate", "hourly", quote.RateID)
+	assertEqual(t, "Invalid Pricing", false, Rate{Days: "wed", Times: "0600-1800", Timezone: "UTC", Pricing: &Pricing{Model: "hourly"}}.Validate() == nil)
+}
+
+func TestDateOverrides(t *testing.T) {
+	dates, err := ParseICalendarDates(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Independence\r\n  Day\r\nDTSTART;VALUE=DATE:20150704\r\nDTEND;VALUE=DATE:20150705\r\nEND:VEVENT\r\nBEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20150901\r\nDTEND;VALUE=DATE:20150904\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "Calendar Dates", "[2015-07-04 2015-09-01/2015-09-03]", fmt.Sprintf("%v", dates))
+
+	dir, _ := ioutil.TempDir("", "rate-api")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "holidays.ics"), []byte("BEGIN:VEVENT\nDTSTART;VALUE=DATE:20150704\nEND:VEVENT\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "rates.json"), []byte(`{"rates":[
+		{"days":"fri,sat,sun","times":"0900-2100","tz":"America/Chicago","price":2000},
+		{"times":"0000-2400","tz":"America/Chicago","price":5000,"calendar":"holidays.ics"},
+		{"days":"sat,sun","times":"0900-2100","tz":"America/Chicago","price":2500,"dates":["2015-06-01/2015-08-31"]}
+	]}`), 0644)
+	store, err := RateStoreFromFile(filepath.Join(dir, "rates.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rates := store.Get()
+	assertEqual(t, "Resolved Calendar", "[2015-07-04]", fmt.Sprintf("%v", rates[1].Dates))
+
+	chicago, _ := time.LoadLocation("America/Chicago")
+	price := func(day int) int {
+		out, err := GetRate(rates, time.Date(2015, 7, day, 10, 0, 0, 0, chicago), time.Date(2015, 7, day, 12, 0, 0, 0, chicago))
+		if err != nil {
+			t.Error(err)
+		}
+		return out
+	}
+	assertEqual(t, "Holiday Override", 5000, price(4))
+	assertEqual(t, "Seasonal Weekend", 2500, price(5))
+	assertEqual(t, "Weekday Rate", 2000, price(3))
+
+	set, _ := store.Snapshot()
+	assertEqual(t, "Calendar Rejected Over Api", false, Rate{Times: "0000-2400", Timezone: "UTC", Calendar: "/etc/passwd"}.Validate() == nil)
+	assertEqual(t, "Valid Set", 0, len(set.Validate()))
+
+	ioutil.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"rates":[{"days":"fri","times":"0900-2100","tz":"America/Chicago","price":2000,"dates":["2015-07-32"]}]}`), 0644)
+	_, err = RateStoreFromFile(filepath.Join(dir, "bad.json"))
+	assertEqual(t, "Invalid File Rejected", true, err != nil)
+	_, err = GetRate([]Rate{{Days: "fri", Times: "0900-2100", Timezone: "America/Chicago", Price: 2000, Dates: []string{"2015-07-32"}}}, time.Date(2015, 7, 3, 10, 0, 0, 0, chicago), time.Date(2015, 7, 3, 12, 0, 0, 0, chicago))
+	assertEqual(t, "Bad Dates Error", true, err != nil)
+}
+
+func TestDayAndTimeExpressions(t *testing.T) {
+	dayCases := map[string]string{
+		"mon,wed,sat":       "[1 3 6]",
+		"Mon-Fri":           "[1 2 3 4 5]",
+		"fri-mon":           "[5 6 0 1]",
+		"tue, Thursday,SUN": "[2 4 0]",
+		"weekends":          "[0 6]",
+		"DAILY":             "[0 1 2 3 4 5 6]",
+	}
+	for expr, expected := range dayCases {
+		out, err := Rate{Days: expr}.GetDays()
+		if err != nil {
+			t.Error(err)
+		}
+		assertEqual(t, "Days "+expr, expected, fmt.Sprintf("%v", out))
+	}
+	for _, expr := range []string{"someday", "mon-", "mon-tue-wed", "", "mon,,tue"} {
+		_, err := Rate{Days: expr}.GetDays()
+		assertEqual(t, "Bad Days "+expr, true, err != nil)
+	}
+
+	timeCases := map[string]string{
+		"0530-0645":         "5h30m0s 6h45m0s",
+		"053015-064500":     "5h30m15s 6h45m0s",
+		"05:30-24:00":       "5h30m0s 24h0m0s",
+		"00:00:00-23:59:59": "0s 23h59m59s",
+	}
+	for expr, expected := range timeCases {
+		start, end, err := Rate{Times: expr}.GetTimes()
+		if err != nil {
+			t.Error(err)
+		}
+		assertEqual(t, "Times "+expr, expected, fmt.Sprintf("%v %v", start, end))
+	}
+	for _, expr := range []string{"2400-2400", "0900-2401", "0960-1000", "900-2100", "0900"} {
+		_, _, err := Rate{Times: expr}.GetTimes()
+		assertEqual(t, "Bad Times "+expr, true, err != nil)
+	}
+}
+
+func TestStayLimits(t *testing.T) {
+	rates := []Rate{
+		Rate{ID: "short", Days: "wed", Times: "0600-1800", Timezone: "America/Chicago", Price: 1000, MaxDuration: "4h"},
+		Rate{ID: "long", Days: "wed", Times: "0600-1800", Timezone: "America/Chicago", Price: 1500, MinDuration: "2h"},
+	}
+	chicago, _ := time.LoadLocation("America/Chicago")
+	quote := func(hours int) Quote {
+		out, err := QuoteRate(Rates{Rates: rates}, RateRequest{StartDate: ISO8601Time{time.Date(2015, 7, 1, 7, 0, 0, 0, chicago)}, EndDate: ISO8601Time{time.Date(2015, 7, 1, 7+hours, 0, 0, 0, chicago)}})
+		if err != nil {
+			t.Error(err)
+		}
+		return out
+	}
+
+	assertEqual(t, "Short Stay", "short", quote(1).RateID)
+	assertEqual(t, "Short Stay Rejection", ReasonTooShort, quote(1).Rejections[0].Reason)
+	assertEqual(t, "Both Fit", "short", quote(3).RateID)
+	assertEqual(t, "Long Stay", "long", quote(5).RateID)
+
+	rates[1].MaxDuration = "6h"
+	tooLong := quote(8)
+	assertEqual(t, "Too Long Available", false, tooLong.Available)
+	assertEqual(t, "Too Long Reason", ReasonTooLong, tooLong.Reason)
+	assertEqual(t, "Too Long Rejections", 2, len(tooLong.Rejections))
+
+	out, _ := QuoteRate(Rates{Rates: rates}, RateRequest{StartDate: ISO8601Time{time.Date(2015, 7, 1, 7, 0, 0, 0, chicago)}, EndDate: ISO8601Time{time.Date(2015, 7, 2, 7, 0, 0, 0, chicago)}})
+	assertEqual(t, "Multiple Days Reason", ReasonMultipleDays, out.Reason)
+	assertEqual(t, "Invalid Limits", false, Rate{Days: "wed", Times: "0600-1800", Timezone: "UTC", MinDuration: "5h", MaxDuration: "4h"}.Validate() == nil)
+}
+
+func TestRateClasses(t *testing.T) {
+	rates := []Rate{
+		Rate{ID: "default", Days: "wed", Times: "0600-1800", Timezone: "America/Chicago", Price: 1000},
+		Rate{ID: "oversize", Days: "wed", Times: "0600-1800", Timezone: "America/Chicago", Price: 1500, RateClass: RateClass{Vehicle: "oversize"}},
+		Rate{ID: "oversize-valet", Days: "wed", Times: "0600-1800", Timezone: "America/Chicago", Price: 2500, RateClass: RateClass{Vehicle: "oversize", Product: "valet"}},
+	}
+	chicago, _ := time.LoadLocation("America/Chicago")
+	quote := func(class RateClass) Quote {
+		out, err := QuoteRate(Rates{Rates: rates}, RateRequest{StartDate: ISO8601Time{time.Date(2015, 7, 1, 7, 0, 0, 0, chicago)}, EndDate: ISO8601Time{time.Date(2015, 7, 1, 9, 0, 0, 0, chicago)}, RateClass: class})
+		if err != nil {
+			t.Error(err)
+		}
+		return out
+	}
+
+	assertEqual(t, "No Class", "default", quote(RateClass{}).RateID)
+	assertEqual(t, "Fallback To Default", "default", quote(RateClass{Vehicle: "motorcycle"}).RateID)
+	assertEqual(t, "Vehicle", "oversize", quote(RateClass{Vehicle: "oversize"}).RateID)
+	assertEqual(t, "Vehicle Other Product", "oversize", quote(RateClass{Vehicle: "oversize", Product: "covered"}).RateID)
+	assertEqual(t, "Vehicle And Product", "oversize-valet", quote(RateClass{Vehicle: "oversize", Product: "valet"}).RateID)
+	assertEqual(t, "Echo Class", "valet", quote(RateClass{Vehicle: "oversize", Product: "valet"}).Product)
+	assertEqual(t, "Invalid Vehicle", false, RateClass{Vehicle: "truck"}.Validate() == nil)
+	assertEqual(t, "Coverage Ignores Classes", 0, len(AnalyzeCoverage(rates).Overlaps))
+
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: rates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore())
+	request, _ := http.NewRequest(http.MethodPost, "/quote", strings.NewReader(`{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T09:00:00-05:00","vehicle":"truck"}`))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "Invalid Request Class", http.StatusUnprocessableEntity, response.Code)
+}
+
+func TestSurgePricing(t *testing.T) {
+	rates := []Rate{
+		Rate{ID: "surge", Days: "wed", Times: "0600-1200", Timezone: "America/Chicago", Price: 1000, Surge: &SurgeBounds{Floor: 800, Ceiling: 1400}},
+		Rate{ID: "fixed", Days: "wed", Times: "1200-1800", Timezone: "America/Chicago", Price: 1000},
+	}
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: rates}, AnyVersion)
+	surge := NewSurgeStore()
+	quoter := NewQuoter(store, NewPromoStore(), surge)
+	quote := func(hour int) Quote {
+		chicago, _ := time.LoadLocation("America/Chicago")
+		out, err := quoter.Quote(RateRequest{StartDate: ISO8601Time{time.Date(2015, 7, 1, hour, 0, 0, 0, chicago)}, EndDate: ISO8601Time{time.Date(2015, 7, 1, hour+1, 0, 0, 0, chicago)}})
+		if err != nil {
+			t.Error(err)
+		}
+		return out
+	}
+
+	assertEqual(t, "No Surge", 1000, quote(7).Price)
+	surge.Set(Surge{Factor: 1.25})
+	assertEqual(t, "Surged", 1250, quote(7).Price)
+	assertEqual(t, "Surge Adjustment", 250, quote(7).SurgeAdjustment)
+	assertEqual(t, "Surge Base Price", 1000, quote(7).BasePrice)
+	assertEqual(t, "Not Surge Enabled", 1000, quote(13).Price)
+	surge.Set(Surge{Factor: 2})
+	assertEqual(t, "Ceiling", 1400, quote(7).Price)
+	surge.Set(Surge{Factor: 0.5})
+	assertEqual(t, "Floor", 800, quote(7).Price)
+	assertEqual(t, "Floor Adjustment", -200, quote(7).SurgeAdjustment)
+	_, err := surge.Set(Surge{Factor: 0})
+	assertEqual(t, "Invalid Factor", false, err == nil)
+	surge.Set(Surge{Factor: 1})
+	rates[0].Surge.Floor = 1200
+	store.Set(Rates{Rates: rates}, AnyVersion)
+	assertEqual(t, "Floor Without Surge", 1200, quote(7).Price)
+	assertEqual(t, "Floor Without Surge Adjustment", 200, quote(7).SurgeAdjustment)
+
+	server := NewServer(store, NewMetricsStore(), WithSurge(surge), WithAdminToken("secret"))
+	send := func(bod string, admin bool) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPut, "/surge", strings.NewReader(bod))
+		if admin {
+			request.Header.Set("Authorization", "Bearer secret")
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	assertEqual(t, "Unauthorized Surge", http.StatusUnauthorized, send(`{"factor":1.5}`, false).Code)
+	assertEqual(t, "Bad Surge", http.StatusUnprocessableEntity, send(`{"factor":50}`, true).Code)
+	// the schema catches out of range factors first, the controller answers the same status without it
+	direct := httptest.NewRecorder()
+	NewSurgeController(surge).ServeHTTP(direct, httptest.NewRequest(http.MethodPut, "/surge", strings.NewReader(`{"factor":50}`)))
+	assertEqual(t, "Invalid Surge Status", http.StatusUnprocessableEntity, direct.Code)
+	assertEqual(t, "Invalid Surge Code", true, strings.Contains(direct.Body.String(), ErrInvalidSurge.Code))
+	assertEqual(t, "Put Surge", http.StatusOK, send(`{"factor":1.5,"occupancy":95}`, true).Code)
+	assertEqual(t, "Surge Stored", 1.5, surge.Get().Factor)
+
+	dir, _ := ioutil.TempDir("", "surge")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "surge.json")
+	ioutil.WriteFile(path, []byte(`{"factor":1.1}`), 0644)
+	assertEqual(t, "Load Surge", nil, surge.Load(path))
+	assertEqual(t, "Loaded Surge", 1.1, surge.Get().Factor)
+}
+
+func TestReservations(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "reservations")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "reservations.json")
+	reservations, err := ReservationStoreFromFile(path, 2)
+	assertEqual(t, "Open Missing File", nil, err)
+
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore(), WithReservations(reservations))
+	send := func(method, path, bod string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(bod))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	sendOwned := func(method string, reservation Reservation, secret string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "/reservations/"+reservation.ID, nil)
+		request.Header.Set("X-Reservation-Secret", secret)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	span := func(start, end string) string {
+		return `{"startDate":"2015-07-01T` + start + `:00-05:00","endDate":"2015-07-01T` + end + `:00-05:00"}`
+	}
+
+	first := send(http.MethodPost, "/reservations", span("07:00", "09:00"))
+	assertEqual(t, "Create", http.StatusCreated, first.Code)
+	var reservation Reservation
+	json.NewDecoder(first.Body).Decode(&reservation)
+	assertEqual(t, "Locked Price", 1750, reservation.Quote.Price)
+	assertEqual(t, "Locked Version", store.Version(), reservation.Quote.Version)
+	assertEqual(t, "Location", "/reservations/"+reservation.ID, first.Header().Get("Location"))
+
+	assertEqual(t, "Second", http.StatusCreated, send(http.MethodPost, "/reservations", span("08:00", "10:00")).Code)
+	assertEqual(t, "Over Capacity", http.StatusConflict, send(http.MethodPost, "/reservations", span("08:30", "09:30")).Code)
+	assertEqual(t, "Back To Back", http.StatusCreated, send(http.MethodPost, "/reservations", span("09:00", "10:00")).Code)
+	assertEqual(t, "Unavailable", http.StatusConflict, send(http.MethodPost, "/reservations", `{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-02T07:00:00-05:00"}`).Code)
+
+	store.Set(Rates{Rates: []Rate{}}, AnyVersion)
+	assertEqual(t, "Get Without Secret", http.StatusNotFound, send(http.MethodGet, "/reservations/"+reservation.ID, "").Code)
+	assertEqual(t, "Get Wrong Secret", http.StatusNotFound, sendOwned(http.MethodGet, reservation, "guess").Code)
+	got := sendOwned(http.MethodGet, reservation, reservation.Secret)
+	assertEqual(t, "Get", http.StatusOK, got.Code)
+	var locked Reservation
+	json.NewDecoder(got.Body).Decode(&locked)
+	assertEqual(t, "Price Survives Rate Change", 1750, locked.Quote.Price)
+
+	reloaded, err := ReservationStoreFromFile(path, 2)
+	assertEqual(t, "Reload", nil, err)
+	_, found := reloaded.Find(reservation.ID)
+	assertEqual(t, "Persisted", true, found)
+
+	assertEqual(t, "Delete Without Secret", http.StatusNotFound, send(http.MethodDelete, "/reservations/"+reservation.ID, "").Code)
+	assertEqual(t, "Delete", http.StatusNoContent, sendOwned(http.MethodDelete, reservation, reservation.Secret).Code)
+	assertEqual(t, "Deleted", http.StatusNotFound, sendOwned(http.MethodGet, reservation, reservation.Secret).Code)
+	assertEqual(t, "Delete Missing", http.StatusNotFound, sendOwned(http.MethodDelete, reservation, reservation.Secret).Code)
+
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	promos := NewPromoStore()
+	promos.Add(Promo{Code: "ONCE", AmountOff: 100, MaxUses: 1})
+	server = NewServer(store, NewMetricsStore(), WithReservations(NewReservationStore(0)), WithPromos(promos))
+	promoSpan := `{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T09:00:00-05:00","promoCode":"ONCE"}`
+	booked := send(http.MethodPost, "/reservations", promoSpan)
+	assertEqual(t, "Promo Booking", http.StatusCreated, booked.Code)
+	json.NewDecoder(booked.Body).Decode(&reservation)
+	once, _ := promos.Find("ONCE")
+	assertEqual(t, "Promo Redeemed", 1, once.Uses)
+	var fullPrice Reservation
+	json.NewDecoder(send(http.MethodPost, "/reservations", promoSpan).Body).Decode(&fullPrice)
+	assertEqual(t, "Promo Used Up", PromoUsedUp, fullPrice.Quote.PromoError)
+	sendOwned(http.MethodDelete, fullPrice, fullPrice.Secret)
+	once, _ = promos.Find("ONCE")
+	assertEqual(t, "Unused Promo Kept", 1, once.Uses)
+	sendOwned(http.MethodDelete, reservation, reservation.Secret)
+	once, _ = promos.Find("ONCE")
+	assertEqual(t, "Promo Released", 0, once.Uses)
+}
+
+func TestQuoteTokens(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	signer := NewQuoteSigner([]byte("secret"), time.Minute)
+	server := NewServer(store, NewMetricsStore(), WithQuoteSigner(signer))
+	send := func(path, bod string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(bod))
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	span := `{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T12:00:00-05:00"}`
+
+	assertEqual(t, "Plain Rate", "1750\n", send("/rate", span).Body.String())
+	var signed SignedRate
+	json.NewDecoder(send("/rate?token=true", span).Body).Decode(&signed)
+	assertEqual(t, "Signed Price", 1750, signed.Price)
+	assertEqual(t, "Unavailable Unsigned", "\"unavailable\"\n", send("/rate?token=true", `{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-02T07:00:00-05:00"}`).Body.String())
+
+	claims, reason := signer.Verify(signed.Token, time.Now())
+	assertEqual(t, "Valid", "", reason)
+	assertEqual(t, "Claims Price", 1750, claims.Price)
+	assertEqual(t, "Claims Version", store.Version(), claims.Version)
+	_, reason = signer.Verify(signed.Token, time.Now().Add(2*time.Minute))
+	assertEqual(t, "Expired", TokenExpired, reason)
+	_, reason = NewQuoteSigner([]byte("other"), time.Minute).Verify(signed.Token, time.Now())
+	assertEqual(t, "Wrong Key", TokenBadSig, reason)
+	_, reason = signer.Verify("not-a-token", time.Now())
+	assertEqual(t, "Malformed", TokenMalformed, reason)
+
+	var quote Quote
+	json.NewDecoder(send("/quote?token=true", span).Body).Decode(&quote)
+	var verification TokenVerification
+	json.NewDecoder(send("/quote/verify", `{"token":"`+quote.Token+`"}`).Body).Decode(&verification)
+	assertEqual(t, "Verify Endpoint", true, verification.Valid)
+	assertEqual(t, "Verify Total", quote.Total, verification.Claims.Total)
+	json.NewDecoder(send("/quote/verify", `{"token":"`+quote.Token+`x"}`).Body).Decode(&verification)
+	assertEqual(t, "Verify Tampered", false, verification.Valid)
+	assertEqual(t, "Verify Missing Token", http.StatusUnprocessableEntity, send("/quote/verify", `{}`).Code)
+}
+
+func TestRateBackends(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "backends")
+	defer os.RemoveAll(dir)
+
+	for _, kind := range []string{StoreFile, StoreBolt, StoreSQLite} {
+		t.Run(kind, func(t *testing.T) {
+			path := filepath.Join(dir, "rates."+kind)
+			store, closeStore, err := OpenRateStore(kind, path, "./rates.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, "Seeded Version", 1, store.Version())
+			assertEqual(t, "Seeded Rates", 5, len(store.Get()))
+
+			rate, _, err := store.Add(Rate{Days: "sun", Times: "0100-0200", Timezone: "UTC", Price: 100}, 1)
+			assertEqual(t, "Add", nil, err)
+			_, _, err = store.Update("b7c6d2f1a0e94c31", 2, func(r *Rate) error {
+				r.Price = 1600
+				return nil
+			})
+			assertEqual(t, "Update", nil, err)
+			closeStore()
+
+			reopened, closeStore, err := OpenRateStore(kind, path, "./rates.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer closeStore()
+			assertEqual(t, "Reopened Version", 3, reopened.Version())
+			set, _ := reopened.Snapshot()
+			assertEqual(t, "Reopened Rates", 6, len(set.Rates))
+			assertEqual(t, "Reopened Update", 1600, set.Rates[0].Price)
+			_, found := reopened.Find(rate.ID)
+			assertEqual(t, "Reopened Add", true, found)
+		})
+	}
+
+	t.Run("stale instance", func(t *testing.T) {
+		path := filepath.Join(dir, "shared.sqlite")
+		first, closeFirst, _ := OpenRateStore(StoreSQLite, path, "./rates.json")
+		defer closeFirst()
+		second, closeSecond, _ := OpenRateStore(StoreSQLite, path, "./rates.json")
+		defer closeSecond()
+		_, err := first.Delete("b7c6d2f1a0e94c31", AnyVersion)
+		assertEqual(t, "First Write", nil, err)
+		_, err = second.Delete("4e1f8a2d9c3b6a70", 1)
+		assertEqual(t, "Stale If-Match", errVersionMismatch, err)
+		change, err := second.Delete("4e1f8a2d9c3b6a70", AnyVersion)
+		assertEqual(t, "Stale Write Reloads", nil, err)
+		assertEqual(t, "Reloaded Version", 3, change.Version)
+		assertEqual(t, "Reloaded Rates", 3, len(second.Get()))
+	})
+
+	_, _, err := OpenRateStore("redis", "", "./rates.json")
+	assertEqual(t, "Unknown Store", false, err == nil)
+}
+
+func TestRateSync(t *testing.T) {
+	leaderStore := &MemoryRateStore{}
+	leaderStore.Set(Rates{Rates: defaultRates}, AnyVersion)
+	leader := httptest.NewServer(NewServer(leaderStore, NewMetricsStore()))
+	defer leader.Close()
+
+	followerStore := &MemoryRateStore{}
+	sync := NewRateSync(followerStore, leader.URL, time.Minute)
+	follower := NewServer(followerStore, NewMetricsStore(), WithRateSync(sync))
+	send := func(method, path, bod string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(bod))
+		response := httptest.NewRecorder()
+		follower.ServeHTTP(response, request)
+		return response
+	}
+
+	assertEqual(t, "Not Ready Before Sync", http.StatusServiceUnavailable, send(http.MethodGet, "/ready", "").Code)
+	assertEqual(t, "First Sync", nil, sync.SyncOnce())
+	assertEqual(t, "Converged", leaderStore.Version(), followerStore.Version())
+	assertEqual(t, "Replicated Rates", 5, len(followerStore.Get()))
+	assertEqual(t, "Ready", http.StatusOK, send(http.MethodGet, "/ready", "").Code)
+	assertEqual(t, "Follower Read Only", http.StatusForbidden, send(http.MethodPost, "/rates", `{"rates":[]}`).Code)
+	assertEqual(t, "Follower Reads", http.StatusOK, send(http.MethodGet, "/rates", "").Code)
+
+	leaderStore.Delete("b7c6d2f1a0e94c31", AnyVersion)
+	assertEqual(t, "Second Sync", nil, sync.SyncOnce())
+	assertEqual(t, "Converged Again", leaderStore.Version(), followerStore.Version())
+	assertEqual(t, "Replicated Delete", 4, len(followerStore.Get()))
+	assertEqual(t, "Unchanged Sync", nil, sync.SyncOnce())
+	assertEqual(t, "Stale", false, sync.Status(time.Now().Add(time.Hour)).InSync)
+
+	response, _ := http.Get(leader.URL + "/rates")
+	response.Body.Close()
+	request, _ := http.NewRequest(http.MethodGet, leader.URL+"/rates", nil)
+	request.Header.Set("If-None-Match", response.Header.Get("ETag"))
+	response, _ = http.DefaultClient.Do(request)
+	response.Body.Close()
+	assertEqual(t, "Not Modified", http.StatusNotModified, response.StatusCode)
+
+	// a leader restarted from its rates file can reach the same version with other rates
+	restarted := &MemoryRateStore{}
+	restarted.Set(Rates{Rates: defaultRates}, AnyVersion)
+	restarted.Set(Rates{Rates: defaultRates[:2]}, AnyVersion)
+	leader.Config.Handler = NewServer(restarted, NewMetricsStore())
+	assertEqual(t, "Restarted Sync", nil, sync.SyncOnce())
+	assertEqual(t, "Same Version", restarted.Version(), followerStore.Version())
+	assertEqual(t, "Resynced Rates", 2, len(followerStore.Get()))
+
+	recorder := httptest.NewRecorder()
+	NewServer(leaderStore, NewMetricsStore()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assertEqual(t, "Leader Ready", http.StatusOK, recorder.Code)
+}
+
+func TestWebhooks(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bod, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- bod
+	}))
+	defer subscriber.Close()
+	failures := 0
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failures++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	dir, _ := ioutil.TempDir("", "webhooks")
+	defer os.RemoveAll(dir)
+	deadLetterPath := filepath.Join(dir, "dead.jsonl")
+	notifier, err := NewWebhookNotifier([]Webhook{
+		Webhook{URL: subscriber.URL, Secret: "secret"},
+		Webhook{URL: broken.URL, Secret: "secret"},
+	}, deadLetterPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier.Attempts = 3
+	notifier.Backoff = time.Millisecond
+
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore(), WithWebhooks(notifier))
+	request, _ := http.NewRequest(http.MethodDelete, "/rates/b7c6d2f1a0e94c31", nil)
+	server.ServeHTTP(httptest.NewRecorder(), request)
+	request, _ = http.NewRequest(http.MethodDelete, "/rates/missing", nil)
+	server.ServeHTTP(httptest.NewRecorder(), request)
+	notifier.Close()
+
+	assertEqual(t, "Delivered Once", 1, len(received))
+	delivery, bod := <-received, <-bodies
+	assertEqual(t, "Signature", WebhookSignature("secret", bod), delivery.Header.Get("X-Rate-API-Signature"))
+	var event WebhookEvent
+	json.Unmarshal(bod, &event)
+	assertEqual(t, "Event Version", 2, event.Version)
+	assertEqual(t, "Event Diff", "b7c6d2f1a0e94c31", event.Diff.Removed[0].ID)
+
+	assertEqual(t, "Retried", 3, failures)
+	file, _ := ioutil.ReadFile(deadLetterPath)
+	var letter DeadLetter
+	json.Unmarshal(file, &letter)
+	assertEqual(t, "Dead Letter URL", broken.URL, letter.URL)
+	assertEqual(t, "Dead Letter Attempts", 3, letter.Attempts)
+	assertEqual(t, "Dead Letter Event", event.ID, letter.Event.ID)
+
+	_, err = NewWebhookNotifier([]Webhook{Webhook{URL: subscriber.URL}}, "")
+	assertEqual(t, "Missing Secret", false, err == nil)
+}
+
+func TestRateStream(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := httptest.NewServer(NewServer(store, NewMetricsStore()))
+	defer server.Close()
+	open := func(query, lastID string) (*bufio.Reader, func()) {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/rates/stream"+query, nil)
+		if lastID != "" {
+			request.Header.Set("Last-Event-ID", lastID)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, "Stream Content Type", "text/event-stream", response.Header.Get("Content-Type"))
+		return bufio.NewReader(response.Body), func() { response.Body.Close() }
+	}
+	// returns the id, event and data lines of the next event
+	next := func(events *bufio.Reader) []string {
+		var out []string
+		for {
+			line, err := events.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimRight(line, "\n")
+			if line == "" {
+				return out
+			}
+			out = append(out, line)
+		}
+	}
+	remove := func(id string) {
+		request, _ := http.NewRequest(http.MethodDelete, server.URL+"/rates/"+id, nil)
+		response, _ := http.DefaultClient.Do(request)
+		response.Body.Close()
+	}
+
+	full, closeFull := open("", "")
+	defer closeFull()
+	initial := next(full)
+	assertEqual(t, "Initial ID", "id: 1", initial[0])
+	assertEqual(t, "Initial Event", "event: rates", initial[1])
+
+	diffs, closeDiffs := open("?mode=diff", "1")
+	defer closeDiffs()
+	remove("b7c6d2f1a0e94c31")
+	update := next(full)
+	assertEqual(t, "Update ID", "id: 2", update[0])
+	var set Rates
+	json.Unmarshal([]byte(strings.TrimPrefix(update[2], "data: ")), &set)
+	assertEqual(t, "Update Rates", 4, len(set.Rates))
+	diff := next(diffs)
+	assertEqual(t, "Diff Event", "event: diff", diff[1])
+	var change RateSetChange
+	json.Unmarshal([]byte(strings.TrimPrefix(diff[2], "data: ")), &change)
+	assertEqual(t, "Diff Removed", "b7c6d2f1a0e94c31", change.Diff.Removed[0].ID)
+
+	remove("4e1f8a2d9c3b6a70")
+	resumed, closeResumed := open("?mode=diff", "1")
+	defer closeResumed()
+	assertEqual(t, "Resume First", "id: 2", next(resumed)[0])
+	assertEqual(t, "Resume Second", "id: 3", next(resumed)[0])
+	unknown, closeUnknown := open("?mode=diff", "99")
+	defer closeUnknown()
+	assertEqual(t, "Unknown Resume", "event: rates", next(unknown)[1])
+
+	controller := NewRateStreamController(store, NewRateBroadcaster())
+	controller.Heartbeat = time.Millisecond
+	quiet := httptest.NewServer(controller)
+	defer quiet.Close()
+	request, _ := http.NewRequest(http.MethodGet, quiet.URL, nil)
+	request.Header.Set("Last-Event-ID", "3")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	line, _ := bufio.NewReader(response.Body).ReadString('\n')
+	assertEqual(t, "Heartbeat", ": heartbeat\n", line)
+
+	// a store restarted behind the version a client has is still streamed
+	broadcaster := NewRateBroadcaster()
+	restarted := httptest.NewServer(NewRateStreamController(store, broadcaster))
+	defer restarted.Close()
+	previous, previousVersion := store.Snapshot()
+	for _, mode := range []string{"", "?mode=diff"} {
+		request, _ = http.NewRequest(http.MethodGet, restarted.URL+mode, nil)
+		request.Header.Set("Last-Event-ID", strconv.Itoa(previousVersion))
+		response, err = http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events := bufio.NewReader(response.Body)
+		change, _ := store.Replicate(Rates{Rates: defaultRates[:2]}, 1)
+		broadcaster.Publish(change)
+		reset := next(events)
+		assertEqual(t, "Restarted ID "+mode, "id: 1", reset[0])
+		assertEqual(t, "Restarted Event "+mode, "event: rates", reset[1])
+		response.Body.Close()
+		store.Replicate(previous, previousVersion)
+	}
+
+	var versions []int
+	ordered := &notifyingRateStore{RateStore: &MemoryRateStore{}, listeners: []func(RateSetChange){func(change RateSetChange) {
+		versions = append(versions, change.Version)
+	}}}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ordered.Set(Rates{Rates: defaultRates}, AnyVersion)
+		}()
+	}
+	wg.Wait()
+	inOrder := sort.IntsAreSorted(versions) && len(versions) == 20
+	assertEqual(t, "Notified In Order", true, inOrder)
+}
+
+func TestGRPC(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	metricsStore := NewMetricsStore()
+	mux, grpcServer := NewServers(store, metricsStore, WithAdminToken("secret"))
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := ratepb.NewRateServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	admin := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret", "x-actor", "pricing-service")
+
+	chicago, _ := time.LoadLocation("America/Chicago")
+	span := func(start, end int) *ratepb.GetRateRequest {
+		return &ratepb.GetRateRequest{
+			Start: timestamppb.New(time.Date(2015, 7, 1, start, 0, 0, 0, chicago)),
+			End:   timestamppb.New(time.Date(2015, 7, 1, end, 0, 0, 0, chicago)),
+		}
+	}
+	quote, err := client.GetRate(ctx, span(7, 12))
+	assertEqual(t, "GetRate Error", nil, err)
+	assertEqual(t, "GetRate Price", int64(1750), quote.Price)
+	batch, err := client.BatchGetRate(ctx, &ratepb.BatchGetRateRequest{Requests: []*ratepb.GetRateRequest{span(7, 12), span(5, 23)}})
+	assertEqual(t, "Batch Error", nil, err)
+	assertEqual(t, "Batch Available", false, batch.Responses[1].Available)
+	_, err = client.GetRate(ctx, &ratepb.GetRateRequest{})
+	assertEqual(t, "Missing Span", codes.InvalidArgument, status.Code(err))
+	_, err = client.GetRate(ctx, span(12, 7))
+	assertEqual(t, "Reversed Span", codes.InvalidArgument, status.Code(err))
+
+	// timestamps arrive in UTC, they must price like the same span sent over http with its offset
+	request, _ := http.NewRequest(http.MethodPost, "/quote", strings.NewReader(`{"startDate":"2015-07-01T16:00:00-05:00","endDate":"2015-07-01T17:30:00-05:00"}`))
+	response := httptest.NewRecorder()
+	mux.ServeHTTP(response, request)
+	var httpQuote Quote
+	json.NewDecoder(response.Body).Decode(&httpQuote)
+	offset := time.FixedZone("", -5*60*60)
+	quote, err = client.GetRate(ctx, &ratepb.GetRateRequest{
+		Start: timestamppb.New(time.Date(2015, 7, 1, 16, 0, 0, 0, offset)),
+		End:   timestamppb.New(time.Date(2015, 7, 1, 17, 30, 0, 0, offset)),
+	})
+	assertEqual(t, "Offset Span Error", nil, err)
+	assertEqual(t, "Offset Span HTTP", true, httpQuote.Available)
+	assertEqual(t, "Offset Span Available", httpQuote.Available, quote.Available)
+	assertEqual(t, "Offset Span Price", int64(httpQuote.Price), quote.Price)
+
+	set, err := client.ListRates(ctx, &ratepb.ListRatesRequest{})
+	assertEqual(t, "List Rates", 5, len(set.Rates))
+	assertEqual(t, "List Version", int64(1), set.Version)
+
+	watch, err := client.WatchRates(ctx, &ratepb.WatchRatesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial, err := watch.Recv()
+	assertEqual(t, "Watch Initial", int64(1), initial.Version)
+
+	set.Rates = set.Rates[1:]
+	_, err = client.SetRates(ctx, &ratepb.SetRatesRequest{Rates: set})
+	assertEqual(t, "Unauthenticated", codes.Unauthenticated, status.Code(err))
+	_, err = client.SetRates(admin, &ratepb.SetRatesRequest{Rates: set, IfVersion: proto.Int64(7)})
+	assertEqual(t, "Stale Version", codes.FailedPrecondition, status.Code(err))
+	updated, err := client.SetRates(admin, &ratepb.SetRatesRequest{Rates: set, IfVersion: proto.Int64(1)})
+	assertEqual(t, "Set Rates", nil, err)
+	assertEqual(t, "Set Version", int64(2), updated.Version)
+	watched, err := watch.Recv()
+	assertEqual(t, "Watch Change", int64(2), watched.Version)
+	assertEqual(t, "Watch Rates", 4, len(watched.Rates))
+
+	// a store restarted behind the version a watcher has is still sent
+	previous, previousVersion := store.Snapshot()
+	services := newServices(store)
+	restarted := services.grpcServer(NewMetricsStore())
+	restartedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go restarted.Serve(restartedListener)
+	defer restarted.Stop()
+	restartedConn, err := grpc.NewClient(restartedListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restartedConn.Close()
+	restartedWatch, err := ratepb.NewRateServiceClient(restartedConn).WatchRates(ctx, &ratepb.WatchRatesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	watched, err = restartedWatch.Recv()
+	assertEqual(t, "Watch Before Restart", int64(previousVersion), watched.Version)
+	replicated, _ := store.Replicate(Rates{Rates: defaultRates[:3]}, 1)
+	services.broadcaster.Publish(replicated)
+	watched, err = restartedWatch.Recv()
+	assertEqual(t, "Watch Went Back", int64(1), watched.Version)
+	assertEqual(t, "Watch Went Back Rates", 3, len(watched.Rates))
+	store.Replicate(previous, previousVersion)
+
+	request, _ = http.NewRequest(http.MethodGet, "/rates", nil)
+	response = httptest.NewRecorder()
+	mux.ServeHTTP(response, request)
+	assertEqual(t, "Shared Store", true, strings.HasPrefix(response.Header().Get("ETag"), `"2-`))
+	assertEqual(t, "Metrics", 1, metricsStore.Get().Metrics["GRPC|"+ratepb.RateService_SetRates_FullMethodName].StatusCodeCount[200])
+}
+
+func TestGraphQL(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore(), WithAdminToken("secret"))
+	type result struct {
+		Data   map[string]json.RawMessage `json:"data"`
+		Errors []struct {
+			Message    string                 `json:"message"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"errors"`
+	}
+	send := func(query string, variables map[string]interface{}, admin bool) result {
+		bod, _ := json.Marshal(GraphQLRequest{Query: query, Variables: variables})
+		request, _ := http.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(bod))
+		request.Header.Set("Content-Type", "application/json")
+		if admin {
+			request.Header.Set("Authorization", "Bearer secret")
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		assertEqual(t, "GraphQL Status", http.StatusOK, response.Code)
+		var out result
+		json.NewDecoder(response.Body).Decode(&out)
+		return out
+	}
+
+	out := send(`{ version rates(day: "Wednesday", maxPrice: 1500) { id price } }`, nil, false)
+	assertEqual(t, "Query Errors", 0, len(out.Errors))
+	assertEqual(t, "Version", "1", string(out.Data["version"]))
+	assertEqual(t, "Filtered Rates", `[{"id":"1c8e3f6a2d9b5704","price":1000}]`, string(out.Data["rates"]))
+
+	out = send(`query($start: String!, $end: String!) { quote(start: $start, end: $end) { available price rateId } }`, map[string]interface{}{
+		"start": "2015-07-01T07:00:00-05:00",
+		"end":   "2015-07-01T12:00:00-05:00",
+	}, false)
+	assertEqual(t, "Quote", `{"available":true,"price":1750,"rateId":"9d2a5c7e1b4f8036"}`, string(out.Data["quote"]))
+
+	out = send(`{ quotes(spans: [
+		{start: "2015-07-01T07:00:00-05:00", end: "2015-07-01T12:00:00-05:00"},
+		{start: "2015-07-01T05:00:00-05:00", end: "2015-07-01T23:00:00-05:00"}
+	]) { available } }`, nil, false)
+	assertEqual(t, "Batch Quotes", `[{"available":true},{"available":false}]`, string(out.Data["quotes"]))
+
+	out = send(`{ quote(start: "yesterday", end: "2015-07-01T12:00:00-05:00") { price } }`, nil, false)
+	assertEqual(t, "Bad Span", 1, len(out.Errors))
+	out = send(`{ quote(start: "2015-07-01T12:00:00-05:00", end: "2015-07-01T07:00:00-05:00") { price } }`, nil, false)
+	assertEqual(t, "Reversed Span", ErrInvalidSpan.Code, out.Errors[0].Extensions["code"])
+
+	mutation := `mutation { addRate(rate: {id: "gql", days: "wed", times: "0500-2300", tz: "America/Chicago", price: 3000}, ifVersion: 1) { id price } }`
+	out = send(mutation, nil, false)
+	assertEqual(t, "Unauthorized", ErrUnauthorized.Title, out.Errors[0].Message)
+	out = send(mutation, nil, true)
+	assertEqual(t, "Add Rate", `{"id":"gql","price":3000}`, string(out.Data["addRate"]))
+	out = send(mutation, nil, true)
+	assertEqual(t, "Stale Version", ErrPrecondition.Title, out.Errors[0].Message)
+
+	out = send(`mutation { updateRate(id: "gql", rate: {days: "wed", times: "0500-2300", tz: "America/Chicago", price: 3500}) { id price } }`, nil, true)
+	assertEqual(t, "Update Rate", `{"id":"gql","price":3500}`, string(out.Data["updateRate"]))
+	out = send(`mutation { deleteRate(id: "missing") }`, nil, true)
+	assertEqual(t, "Delete Missing", ErrNotFound.Title, out.Errors[0].Message)
+	out = send(`mutation { deleteRate(id: "gql", ifVersion: 3) }`, nil, true)
+	assertEqual(t, "Delete Rate", "4", string(out.Data["deleteRate"]))
+
+	out = send(`mutation { setRates(rates: [{days: "wed", times: "0600-1800", tz: "America/Chicago", price: 1750}], policy: "lowest-price") { version policy rates { price } } }`, nil, true)
+	assertEqual(t, "Set Rates", `{"policy":"lowest-price","rates":[{"price":1750}],"version":5}`, string(out.Data["setRates"]))
+	assertEqual(t, "Store Rates", 1, len(store.Get()))
+
+	request, _ := http.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape("{ policy }"), nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "GET Query", `{"data":{"policy":"lowest-price"}}`, strings.TrimSpace(response.Body.String()))
+
+	request, _ = http.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(`mutation { deleteRate(id: "x") }`), nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "GET Mutation", http.StatusMethodNotAllowed, response.Code)
+	assertEqual(t, "GET Mutation Allow", http.MethodPost, response.Header().Get("Allow"))
+	assertEqual(t, "GET Mutation Rates", 1, len(store.Get()))
+
+	bod, _ := json.Marshal(GraphQLRequest{Query: `mutation { deleteRate(id: "x") }`})
+	request, _ = http.NewRequest(http.MethodPost, "/graphql", bytes.NewReader(bod))
+	request.Header.Set("Content-Type", "text/plain")
+	request.Header.Set("Authorization", "Bearer secret")
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "Form Content Type", http.StatusUnsupportedMediaType, response.Code)
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	err := json.Unmarshal(openAPISpec, &spec)
+	assertEqual(t, "Spec JSON", nil, err)
+	assertEqual(t, "Spec Version", "3.0.3", spec.OpenAPI)
+
+	// every $ref points at a schema in the document
+	var doc struct {
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	json.Unmarshal(openAPISpec, &doc)
+	for _, v := range regexp.MustCompile(`"\$ref": "#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(openAPISpec), -1) {
+		_, found := doc.Components.Schemas[v[1]]
+		assertEqual(t, "Schema "+v[1], true, found)
+	}
+
+	routes := newServices(&MemoryRateStore{}).httpRoutes(NewMetricsStore())
+	mux := http.NewServeMux()
+	controllers := map[string]Handler{}
+	for _, v := range routes {
+		mux.Handle(v.pattern, v.controller)
+		controllers[v.pattern] = v.controller
+	}
+
+	documented := map[string]bool{}
+	for path, operations := range spec.Paths {
+		concrete := regexp.MustCompile(`\{[^}]+\}`).ReplaceAllString(path, "x")
+		for method := range operations {
+			method = strings.ToUpper(method)
+			_, pattern := mux.Handler(httptest.NewRequest(method, concrete, nil))
+			_, served := controllers[pattern][method]
+			assertEqual(t, "Served "+method+" "+path, true, served)
+			documented[method+" "+pattern] = true
+		}
+	}
+	for _, v := range routes {
+		for method := range v.controller {
+			assertEqual(t, "Documented "+method+" "+v.pattern, true, documented[method+" "+v.pattern])
+		}
+	}
+
+	server := NewServer(&MemoryRateStore{}, NewMetricsStore())
+	request, _ := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "Spec Status", http.StatusOK, response.Code)
+	assertEqual(t, "Spec Body", string(openAPISpec), response.Body.String())
+	request, _ = http.NewRequest(http.MethodGet, "/docs", nil)
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "Docs Status", http.StatusOK, response.Code)
+	assertEqual(t, "Docs Type", "text/html; charset=utf-8", response.Header().Get("Content-Type"))
+}
+
+func TestRequestValidation(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore(), WithAdminToken("secret"))
+	send := func(method, path, bod string, admin bool) (int, Problem) {
+		request, _ := http.NewRequest(method, path, strings.NewReader(bod))
+		if admin {
+			request.Header.Set("Authorization", "Bearer secret")
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var out Problem
+		json.NewDecoder(response.Body).Decode(&out)
+		return response.Code, out
+	}
+	span := `"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T12:00:00-05:00"`
+
+	code, _ := send(http.MethodPost, "/quote", "{"+span+"}", false)
+	assertEqual(t, "Valid Quote", http.StatusOK, code)
+	code, out := send(http.MethodPost, "/quote", `{`+span+`,"promo":"SUMMER"}`, false)
+	assertEqual(t, "Unknown Field Status", http.StatusUnprocessableEntity, code)
+	assertEqual(t, "Unknown Field", fmt.Sprint([]FieldError{{"/promo", "is not a known field"}}), fmt.Sprint(out.Errors))
+	code, out = send(http.MethodPost, "/rate", `{"endDate":"2015-07-01T12:00:00-05:00"}`, false)
+	assertEqual(t, "Missing Field Status", http.StatusUnprocessableEntity, code)
+	assertEqual(t, "Missing Field", fmt.Sprint([]FieldError{{"/startDate", "is required"}}), fmt.Sprint(out.Errors))
+	reversed := `{"startDate":"2015-07-01T12:00:00-05:00","endDate":"2015-07-01T07:00:00-05:00"}`
+	code, out = send(http.MethodPost, "/reservations", reversed, false)
+	assertEqual(t, "End Before Start Status", http.StatusUnprocessableEntity, code)
+	assertEqual(t, "End Before Start", ErrInvalidSpan.Code, out.Code)
+	_, out = send(http.MethodPost, "/quote", reversed, false)
+	assertEqual(t, "Quote End Before Start", ErrInvalidSpan.Code, out.Code)
+	var req RateRequest
+	json.Unmarshal([]byte(reversed), &req)
+	_, err := QuoteRate(Rates{Rates: defaultRates}, req)
+	assertEqual(t, "QuoteRate End Before Start", true, err != nil)
+	_, out = send(http.MethodPost, "/quote", `{"startDate":"2015-07-01 07:00","endDate":"2015-07-01T12:00:00-05:00","vehicle":"truck"}`, false)
+	assertEqual(t, "Bad Values", fmt.Sprint([]FieldError{{"/startDate", "must be a time like " + ISO8601}, {"/vehicle", "must be one of car, oversize, motorcycle, ev"}}), fmt.Sprint(out.Errors))
+
+	code, out = send(http.MethodPost, "/quote", `{"startDate":`, false)
+	assertEqual(t, "Bad JSON", http.StatusBadRequest, code)
+	assertEqual(t, "Bad JSON Error", ErrBadBody.Code, out.Code)
+	code, out = send(http.MethodPost, "/quote", ``, false)
+	assertEqual(t, "Missing Body", http.StatusBadRequest, code)
+	assertEqual(t, "Missing Body Error", ErrMissingBody.Code, out.Code)
+
+	code, out = send(http.MethodPost, "/quote?tokn=true", "{"+span+"}", false)
+	assertEqual(t, "Unknown Query Status", http.StatusBadRequest, code)
+	assertEqual(t, "Unknown Query", fmt.Sprint([]FieldError{{"tokn", "is not a known parameter"}}), fmt.Sprint(out.Errors))
+	code, _ = send(http.MethodGet, "/rates?_=1700000000", "", false)
+	assertEqual(t, "Cache Buster", http.StatusOK, code)
+	code, out = send(http.MethodPost, "/quote", `{`+span+`,"vehicle":"`+strings.Repeat("x", maxRequestBody)+`"}`, false)
+	assertEqual(t, "Large Body Status", http.StatusRequestEntityTooLarge, code)
+	assertEqual(t, "Large Body", ErrBodyTooLarge.Code, out.Code)
+	_, out = send(http.MethodGet, "/rates/coverage?year=0", "", false)
+	assertEqual(t, "Query Range", fmt.Sprint([]FieldError{{"year", "must be at least 1"}}), fmt.Sprint(out.Errors))
+	_, out = send(http.MethodGet, "/rates/stream?mode=full", "", false)
+	assertEqual(t, "Query Enum", fmt.Sprint([]FieldError{{"mode", "must be one of rates, diff"}}), fmt.Sprint(out.Errors))
+
+	rate := `{"days":"wed","times":"0600-1800","tz":"America/Chicago","price":1750,"pricing":{"model":"first-hour","cap":100}}`
+	code, _ = send(http.MethodPost, "/promos", `{"code":1}`, false)
+	assertEqual(t, "Auth Before Validation", http.StatusUnauthorized, code)
+	_, out = send(http.MethodPost, "/rates", rate, true)
+	assertEqual(t, "Nested Unknown Field", fmt.Sprint([]FieldError{{"/pricing/cap", "is not a known field"}}), fmt.Sprint(out.Errors))
+	_, out = send(http.MethodPost, "/rates", `{"rates":[{"days":"wed","times":"0600-1800","tz":"America/Chicago","price":1750},{"times":"0600-1800","price":-1}]}`, true)
+	assertEqual(t, "Rate Set Errors", fmt.Sprint([]FieldError{{"/rates/1/tz", "is required"}, {"/rates/1/price", "must be at least 0"}}), fmt.Sprint(out.Errors))
+	assertEqual(t, "Rates Unchanged", 1, store.Version())
+	code, _ = send(http.MethodPatch, "/rates/"+defaultRates[0].ID, `{"price":1600}`, true)
+	assertEqual(t, "Partial Patch", http.StatusOK, code)
+}
+
+func TestProblemResponses(t *testing.T) {
+	store := &MemoryRateStore{}
+	// stored without validation, like a hand edited rates file
+	store.Set(Rates{Rates: []Rate{{ID: "mars", Days: "wed", Times: "0600-1800", Timezone: "Mars/Olympus_Mons", Price: 1750}}}, AnyVersion)
+	server := NewServer(store, NewMetricsStore(), WithAdminToken("secret"))
+	send := func(method, path, bod string) (*httptest.ResponseRecorder, Problem) {
+		request, _ := http.NewRequest(method, path, strings.NewReader(bod))
+		request.Header.Set("Authorization", "Bearer secret")
+		request.Header.Set("X-Request-ID", "problem-test")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		var out Problem
+		json.NewDecoder(response.Body).Decode(&out)
+		return response, out
+	}
+
+	response, out := send(http.MethodPost, "/quote", `{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T12:00:00-05:00"}`)
+	assertEqual(t, "Rate Data Status", http.StatusInternalServerError, response.Code)
+	assertEqual(t, "Content Type", "application/problem+json", response.Header().Get("Content-Type"))
+	assertEqual(t, "Rate Data Code", ErrRateData.Code, out.Code)
+	assertEqual(t, "Rate Data Type", "urn:rate-api:error:rate-data", out.Type)
+	assertEqual(t, "Rate Data Cause", "unknown time zone Mars/Olympus_Mons", out.Detail)
+	assertEqual(t, "Instance", "/quote", out.Instance)
+	assertEqual(t, "Request ID", "problem-test", out.RequestID)
+
+	response, out = send(http.MethodPost, "/rates", `{"rates":[{"days":"wed","times":"1800-0600","tz":"America/Chicago","price":100}]}`)
+	assertEqual(t, "Invalid Rate Status", http.StatusUnprocessableEntity, response.Code)
+	assertEqual(t, "Invalid Rate Code", ErrInvalidRate.Code, out.Code)
+	assertEqual(t, "Invalid Rate Pointer", "/rates/0", out.Errors[0].Pointer)
+
+	response, out = send(http.MethodPut, "/rates/missing", `{"days":"wed","times":"0600-1800","tz":"America/Chicago","price":100}`)
+	assertEqual(t, "Store Error", http.StatusNotFound, response.Code)
+	assertEqual(t, "Store Error Code", ErrNotFound.Code, out.Code)
+	response, out = send(http.MethodGet, "/nowhere", "")
+	assertEqual(t, "Unknown Path", http.StatusNotFound, response.Code)
+	assertEqual(t, "Unknown Path Code", ErrRouteNotFound.Code, out.Code)
+	_, out = send(http.MethodDelete, "/quote", "")
+	assertEqual(t, "Unknown Method Code", ErrRouteNotFound.Code, out.Code)
+
+	panics := MiddlewareChain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), NewRequestIDMiddleware(), NewRecoveryMiddleware())
+	request, _ := http.NewRequest(http.MethodGet, "/panic", nil)
+	recorder := httptest.NewRecorder()
+	panics.ServeHTTP(recorder, request)
+	json.NewDecoder(recorder.Body).Decode(&out)
+	assertEqual(t, "Panic Status", http.StatusInternalServerError, recorder.Code)
+	assertEqual(t, "Panic Code", ErrInternal.Code, out.Code)
+	assertEqual(t, "Panic Request ID", recorder.Header().Get("X-Request-ID"), out.RequestID)
+
+	// the published catalog is the one the api answers with
+	var spec struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]struct {
+					Enum []string `json:"enum"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	json.Unmarshal(openAPISpec, &spec)
+	assertEqual(t, "Catalog", fmt.Sprint(errorCodes()), fmt.Sprint(spec.Components.Schemas["Problem"].Properties["code"].Enum))
+}
+
+func TestPromos(t *testing.T) {
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates}, AnyVersion)
+	server := NewServer(store, NewMetricsStore(), WithAdminToken("secret"))
+	send := func(method, path, bod string, admin bool) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(bod))
+		if admin {
+			request.Header.Set("Authorization", "Bearer secret")
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, request)
+		return response
+	}
+	promo := `{"code":"WED10","percentOff":10,"maxUses":1,"days":"wed","times":"0600-1800","tz":"America/Chicago"}`
+
+	assertEqual(t, "Unauthorized Create", http.StatusUnauthorized, send(http.MethodPost, "/promos", promo, false).Code)
+	assertEqual(t, "Public Rates Read", http.StatusOK, send(http.MethodGet, "/rates", "", false).Code)
+	assertEqual(t, "Create", http.StatusCreated, send(http.MethodPost, "/promos", promo, true).Code)
+	assertEqual(t, "Duplicate", http.StatusConflict, send(http.MethodPost, "/promos", promo, true).Code)
+	assertEqual(t, "Invalid", http.StatusUnprocessableEntity, send(http.MethodPost, "/promos", `{"code":"BOTH","percentOff":10,"amountOff":100}`, true).Code)
+
+	quote := func(req string) Quote {
+		var out Quote
+		json.Unmarshal(send(http.MethodPost, "/quote", req, false).Body.Bytes(), &out)
+		return out
+	}
+	discounted := quote(`{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T12:00:00-05:00","promoCode":"wed10"}`)
+	assertEqual(t, "Base Price", 1750, discounted.BasePrice)
+	assertEqual(t, "Discount", 175, discounted.Discount)
+	assertEqual(t, "Discounted Price", 1575, discounted.Price)
+
+	ineligible := quote(`{"startDate":"2015-07-02T09:00:00-05:00","endDate":"2015-07-02T12:00:00-05:00","promoCode":"WED10"}`)
+	assertEqual(t, "Ineligible Span", PromoNotAllowed, ineligible.PromoError)
+	assertEqual(t, "Ineligible Price", 1500, ineligible.Price)
+	assertEqual(t, "Unknown Code", PromoUnknown, quote(`{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T12:00:00-05:00","promoCode":"NOPE"}`).PromoError)
+
+	assertEqual(t, "Redeem", http.StatusOK, send(http.MethodPost, "/promos/WED10/redeem", "", true).Code)
+	assertEqual(t, "Redeem Cap", http.StatusConflict, send(http.MethodPost, "/promos/WED10/redeem", "", true).Code)
+	usedUp := quote(`{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T12:00:00-05:00","promoCode":"WED10"}`)
+	assertEqual(t, "Used Up", PromoUsedUp, usedUp.PromoError)
+
+	fixed := Promo{AmountOff: 5000}
+	assertEqual(t, "Fixed Discount Capped", 1750, fixed.DiscountFor(1750))
+	assertEqual(t, "Delete", http.StatusNoContent, send(http.MethodDelete, "/promos/WED10", "", true).Code)
+
+	server = NewServer(store, NewMetricsStore())
+	assertEqual(t, "No Token Refused", http.StatusUnauthorized, send(http.MethodGet, "/promos", "", true).Code)
+
+	dir, _ := ioutil.TempDir("", "rate-api")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "promos.json")
+	ioutil.WriteFile(path, []byte(`{"promos":[{"code":"JULY","amountOff":100,"maxUses":5,"uses":2}]}`), 0644)
+	promos, err := PromoStoreFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	promos.Redeem("july")
+	promos.Add(Promo{Code: "AUG", PercentOff: 5})
+	reloaded, err := PromoStoreFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	july, _ := reloaded.Find("JULY")
+	assertEqual(t, "Persisted Uses", 3, july.Uses)
+	assertEqual(t, "Persisted Promos", 2, len(reloaded.List()))
+}
+
+func TestCharges(t *testing.T) {
+	charges := []Charge{
+		Charge{Name: "City parking tax", Type: ChargeTax, Percent: 22, OnFees: true},
+		Charge{Name: "Service fee", Type: ChargeFee, Amount: 150},
+		Charge{Name: "Sales tax", Type: ChargeTax, Percent: 10.25},
+	}
+	store := &MemoryRateStore{}
+	store.Set(Rates{Rates: defaultRates, Charges: charges}, AnyVersion)
+	server := NewServer(store, NewMetricsStore())
+
+	request, _ := http.NewRequest(http.MethodPost, "/quote", strings.NewReader(`{"startDate":"2015-07-01T07:00:00-05:00","endDate":"2015-07-01T12:00:00-05:00"}`))
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	var quote Quote
+	json.Unmarshal(response.Body.Bytes(), &quote)
+
+	// fee 150, city tax 22% of 1900 = 418, sales tax 10.25% of 1750 = 179.375 -> 179
+	assertEqual(t, "Line Items", fmt.Sprintf("%v", []LineItem{
+		LineItem{Name: "Service fee", Type: ChargeFee, Amount: 150},
+		LineItem{Name: "City parking tax", Type: ChargeTax, Amount: 418},
+		LineItem{Name: "Sales tax", Type: ChargeTax, Amount: 179},
+	}), fmt.Sprintf("%v", quote.LineItems))
+	assertEqual(t, "Price", 1750, quote.Price)
+	assertEqual(t, "Total", 2497, quote.Total)
+
+	request, _ = http.NewRequest(http.MethodPost, "/rates", strings.NewReader(`{"rates":[],"charges":[{"name":"Tax","type":"tax","percent":10,"amount":5}]}`))
+	response = httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	assertEqual(t, "Invalid Charge", http.StatusUnprocessableEntity, response.Code)
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/subtle"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -17,6 +19,13 @@ func (interceptor *statusInterceptor) WriteHeader(code int) {
 	interceptor.ResponseWriter.WriteHeader(code)
 }
 
+// passes flushes through so streaming responses work behind the middleware
+func (interceptor *statusInterceptor) Flush() {
+	if flusher, ok := interceptor.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 type Middleware func(http.Handler) http.Handler
 
 func MiddlewareChain(h http.Handler, m ...Middleware) http.Handler {
@@ -57,15 +66,7 @@ func NewRecoveryMiddleware() func(http.Handler) http.Handler {
 				err := recover()
 				if err != nil {
 					fmt.Printf("Api Panic Recovered:%s", err)
-					response := ErrorResponse{
-						Error: ErrInternal,
-					}
-
-					bod, _ := json.Marshal(response)
-
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(http.StatusInternalServerError)
-					w.Write(bod)
+					webError(w, r, ErrInternal, "")
 				}
 			}()
 
@@ -73,3 +74,93 @@ func NewRecoveryMiddleware() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+type requestIDKey struct{}
+
+// Tags every request with an id, reusing the callers X-Request-ID when present, and echoes it back in the response
+func NewRequestIDMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-ID")
+			if id == "" || len(id) > 128 {
+				id = newRateID()
+			}
+			w.Header().Set("X-Request-ID", id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+func requestIDFromRequest(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// Reports whether r carries the admin bearer token, nothing is authorized when there is no token so an
+// unset token keeps guarded endpoints closed
+func adminAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	return strings.HasPrefix(auth, "Bearer ") && subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(token)) == 1
+}
+
+type principalKey struct{}
+
+// principal recorded for requests that presented the admin token
+const adminPrincipal = "admin"
+
+// principal recorded when no credentials were checked
+const anonymousPrincipal = "anonymous"
+
+// Marks r as made by the admin once its token has been checked
+func withAdminPrincipal(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, adminPrincipal))
+}
+
+func principalFromRequest(r *http.Request) string {
+	principal, _ := r.Context().Value(principalKey{}).(string)
+	if principal == "" {
+		return anonymousPrincipal
+	}
+	return principal
+}
+
+// Records the admin principal on any request that presents a valid admin token, guarded or not,
+// so changes on open routes are attributed to whoever authenticated. Nothing is refused here.
+func NewPrincipalMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if adminAuthorized(r, token) {
+				r = withAdminPrincipal(r)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Guards admin endpoints with a bearer token, reads are only guarded when protectReads is set.
+// An empty token refuses every guarded request so a missing setting never leaves them open.
+func NewAdminAuthMiddleware(token string, protectReads bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			read := r.Method == http.MethodGet || r.Method == http.MethodHead
+			if read && !protectReads {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if token == "" {
+				webError(w, r, ErrUnauthorized, "admin endpoints are disabled, no admin token is configured")
+				return
+			}
+			if !adminAuthorized(r, token) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="rate-api"`)
+				webError(w, r, ErrUnauthorized, "")
+				return
+			}
+			next.ServeHTTP(w, withAdminPrincipal(r))
+		})
+	}
+}
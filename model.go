@@ -1,13 +1,18 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,7 +21,7 @@ type Handler map[string]http.Handler
 func (c Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	handler, found := c[r.Method]
 	if !found {
-		http.NotFound(w, r)
+		webError(w, r, ErrRouteNotFound, "")
 		return
 	}
 	handler.ServeHTTP(w, r)
@@ -25,54 +30,121 @@ func (c Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type RateRequest struct {
 	StartDate ISO8601Time `json:"startDate"`
 	EndDate   ISO8601Time `json:"endDate"`
+	PromoCode string      `json:"promoCode,omitempty"`
+	RateClass
 }
 
+// Checks the span and class the same way for every transport
+func (req RateRequest) Validate() error {
+	if req.EndDate.Before(req.StartDate.Time) {
+		return errors.New("Invalid 'endDate' must not be before 'startDate'")
+	}
+	return req.RateClass.Validate()
+}
+
+// A rate set document, Policy decides which rate wins when several match (see QuoteRate)
+// and Charges are the taxes and fees added on top of every quote (see ApplyCharges)
 type Rates struct {
-	Rates []Rate `json:"rates"`
+	Rates   []Rate   `json:"rates"`
+	Policy  string   `json:"policy,omitempty"`
+	Charges []Charge `json:"charges,omitempty"`
 }
 
 /*
 Example Rate:
-{
-	"days": "mon,tues,thurs",
-	"times": "0900-2100",
-	"tz": "America/Chicago",
-	"price": 1500
-},
+
+	{
+		"id": "a1b2c3d4e5f60718",
+		"days": "mon,tues,thurs",
+		"times": "0900-2100",
+		"tz": "America/Chicago",
+		"price": 1500
+	},
 */
 type Rate struct {
+	ID       string `json:"id,omitempty"`
 	Price    int    `json:"price"`
 	Timezone string `json:"tz"`
 	Times    string `json:"times"`
 	Days     string `json:"days"`
+	// only used by the "priority" policy, higher wins
+	Priority int `json:"priority,omitempty"`
+	// optional duration based pricing, Price is charged as a flat amount without it
+	Pricing *Pricing `json:"pricing,omitempty"`
+	// optional calendar dates or ranges, see AppliesOn. Date rates take precedence over weekday only rates
+	Dates []string `json:"dates,omitempty"`
+	// path to an iCalendar file whose events are added to Dates, only supported in rates files
+	Calendar string `json:"calendar,omitempty"`
+	// optional stay limits as durations such as "2h" or "90m", spans outside them are rejected
+	MinDuration string `json:"minDuration,omitempty"`
+	MaxDuration string `json:"maxDuration,omitempty"`
+	// optional vehicle class / product tier, rates without one are the default for every class
+	RateClass
+	// optional surge pricing bounds, only rates with them follow the surge factor
+	Surge *SurgeBounds `json:"surge,omitempty"`
 }
 
 // Returns the start and end time offsets respectively
 // if R.Times == 0530-0645 it will return 5h30m and 6h45m durations
+// times may be written as 0530, 053000, 05:30 or 05:30:00 and the end may be 2400 / 24:00 for end of day
 func (r Rate) GetTimes() (time.Duration, time.Duration, error) {
 	timesRaw := strings.Split(r.Times, "-")
 	if len(timesRaw) != 2 {
 		return 0, 0, errors.New("Invalid 'times' format expected 0000-0000")
 	}
-	startHour, err := strconv.ParseInt(timesRaw[0][0:2], 10, 8)
-	if err != nil {
-		return 0, 0, err
+	startOffset, err := parseTimeOfDay(timesRaw[0])
+	if err != nil || startOffset >= 24*time.Hour {
+		return 0, 0, fmt.Errorf("Invalid 'times' start %q expected 0000 to 2359", timesRaw[0])
 	}
-	startMinute, err := strconv.ParseInt(timesRaw[0][2:], 10, 8)
+	endOffset, err := parseTimeOfDay(timesRaw[1])
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, fmt.Errorf("Invalid 'times' end %q expected 0000 to 2400", timesRaw[1])
 	}
-	endHour, err := strconv.ParseInt(timesRaw[1][0:2], 10, 8)
-	if err != nil {
-		return 0, 0, err
+	return startOffset, endOffset, nil
+}
+
+// parses HHMM, HHMMSS, HH:MM or HH:MM:SS into an offset from midnight, 24:00 is the only valid time in hour 24
+func parseTimeOfDay(s string) (time.Duration, error) {
+	s = strings.Replace(strings.TrimSpace(s), ":", "", -1)
+	if len(s) != 4 && len(s) != 6 {
+		return 0, errors.New("invalid time of day")
 	}
-	endMinute, err := strconv.ParseInt(timesRaw[1][2:], 10, 8)
-	if err != nil {
-		return 0, 0, err
+
+	var parts [3]int64
+	for i := 0; i < len(s)/2; i++ {
+		v, err := strconv.ParseInt(s[i*2:i*2+2], 10, 8)
+		if err != nil || v < 0 {
+			return 0, errors.New("invalid time of day")
+		}
+		parts[i] = v
 	}
-	startOffset := time.Duration(startHour)*time.Hour + time.Duration(startMinute)*time.Minute
-	endOffset := time.Duration(endHour)*time.Hour + time.Duration(endMinute)*time.Minute
-	return startOffset, endOffset, nil
+	hour, minute, second := parts[0], parts[1], parts[2]
+	if hour > 24 || minute > 59 || second > 59 || (hour == 24 && (minute > 0 || second > 0)) {
+		return 0, errors.New("invalid time of day")
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second, nil
+}
+
+// Returns the minimum and maximum stay, 0 means no limit
+func (r Rate) GetStayLimits() (time.Duration, time.Duration, error) {
+	var min, max time.Duration
+	var err error
+	if r.MinDuration != "" {
+		min, err = time.ParseDuration(r.MinDuration)
+		if err != nil || min < 0 {
+			return 0, 0, fmt.Errorf("Invalid 'minDuration' %q expected a duration such as 2h or 90m", r.MinDuration)
+		}
+	}
+	if r.MaxDuration != "" {
+		max, err = time.ParseDuration(r.MaxDuration)
+		if err != nil || max <= 0 {
+			return 0, 0, fmt.Errorf("Invalid 'maxDuration' %q expected a duration such as 4h or 90m", r.MaxDuration)
+		}
+	}
+	if max > 0 && min > max {
+		return 0, 0, errors.New("'minDuration' must not be longer than 'maxDuration'")
+	}
+	return min, max, nil
 }
 
 var days = map[string]int{
@@ -85,17 +157,162 @@ var days = map[string]int{
 	"sat":   6,
 }
 
+// other accepted spellings of days, full names and three letter abbreviations
+var dayAliases = map[string]int{
+	"sunday":    0,
+	"monday":    1,
+	"tue":       2,
+	"tuesday":   2,
+	"wednesday": 3,
+	"thu":       4,
+	"thursday":  4,
+	"friday":    5,
+	"saturday":  6,
+}
+
+// named groups of days
+var dayGroups = map[string][]int{
+	"weekdays": []int{1, 2, 3, 4, 5},
+	"weekends": []int{0, 6},
+	"daily":    []int{0, 1, 2, 3, 4, 5, 6},
+}
+
+func parseDay(s string) (int, bool) {
+	day, found := days[s]
+	if !found {
+		day, found = dayAliases[s]
+	}
+	return day, found
+}
+
 // Returns the int version of days, matching  stdlib sunday = 0
 // if r.Days is "mon,wed,sat" this will return []{1,3,6}
-func (r Rate) GetDays() []int {
-	daysRaw := strings.Split(r.Days, ",")
+// entries are case insensitive and may be day names ("mon", "tue", "tues", "monday"),
+// ranges ("mon-fri", "fri-mon" wraps around the weekend) or "weekdays", "weekends" and "daily"
+func (r Rate) GetDays() ([]int, error) {
+	daysRaw := strings.Split(strings.ToLower(r.Days), ",")
 	out := make([]int, 0, len(daysRaw))
 	for _, v := range daysRaw {
-		out = append(out, days[v])
+		v = strings.TrimSpace(v)
+		if group, found := dayGroups[v]; found {
+			out = append(out, group...)
+			continue
+		}
+
+		bounds := strings.Split(v, "-")
+		first, found := parseDay(bounds[0])
+		if !found || len(bounds) > 2 {
+			return nil, fmt.Errorf("Invalid 'days' entry %q", v)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, found = parseDay(bounds[1])
+			if !found {
+				return nil, fmt.Errorf("Invalid 'days' entry %q", v)
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			out = append(out, day)
+			if day == last {
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+// Checks that the rate can be priced, GetRate errors on rates that fail this
+func (r Rate) Validate() error {
+	if r.Price < 0 {
+		return errors.New("'price' must not be negative")
+	}
+	if r.Pricing != nil {
+		err := r.Pricing.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := time.LoadLocation(r.Timezone)
+	if err != nil || r.Timezone == "" {
+		return fmt.Errorf("Invalid 'tz' %q", r.Timezone)
+	}
+	start, end, err := r.GetTimes()
+	if err != nil {
+		return err
+	}
+	if start >= end || end > 24*time.Hour {
+		return fmt.Errorf("Invalid 'times' %q expected start before end within a single day", r.Times)
+	}
+	if r.Calendar != "" {
+		return errors.New("'calendar' is only supported in rates files, send 'dates' instead")
+	}
+	_, _, err = r.GetStayLimits()
+	if err != nil {
+		return err
+	}
+	err = r.RateClass.Validate()
+	if err != nil {
+		return err
+	}
+	if r.Surge != nil {
+		err = r.Surge.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range r.Dates {
+		_, _, err := parseDateRange(v)
+		if err != nil {
+			return err
+		}
+	}
+	if r.Days == "" && len(r.Dates) > 0 {
+		return nil
+	}
+	_, err = r.GetDays()
+	return err
+}
+
+// Describes why a rate in a rate set failed validation
+type RateValidationError struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Err   string `json:"error"`
+}
+
+func (e *RateValidationError) Error() string {
+	if e.Index < 0 {
+		return e.Err
+	}
+	if e.ID != "" {
+		return fmt.Sprintf("Invalid rate %s: %s", e.ID, e.Err)
+	}
+	return fmt.Sprintf("Invalid rate at index %d: %s", e.Index, e.Err)
+}
+
+// Validates every rate in the set and returns all failures
+func ValidateRates(rates []Rate) []*RateValidationError {
+	var out []*RateValidationError
+	for i, v := range rates {
+		err := v.Validate()
+		if err != nil {
+			out = append(out, &RateValidationError{Index: i, ID: v.ID, Err: err.Error()})
+		}
 	}
 	return out
 }
 
+// Validates the policy, charges and every rate in the set, set level errors are reported with an Index of -1
+func (set Rates) Validate() []*RateValidationError {
+	var out []*RateValidationError
+	err := ValidatePolicy(set.Policy)
+	if err != nil {
+		out = append(out, &RateValidationError{Index: -1, Err: err.Error()})
+	}
+	out = append(out, ValidateCharges(set.Charges)...)
+	return append(out, ValidateRates(set.Rates)...)
+}
+
 // ISO8601 date format string
 var ISO8601 = "2006-01-02T15:04:05-07:00"
 
@@ -119,20 +336,267 @@ func (t ISO8601Time) MarshalJSON() ([]byte, error) {
 	return []byte(out), nil
 }
 
-// Store to manage the current active rates
-type RateStore struct {
-	rates []Rate
+// Store to manage the current active rates.
+// Every successful mutation bumps the version which is exposed to clients as an ETag
+// so that concurrent edits can be rejected instead of silently clobbering each other.
+type RateStore interface {
+	Get() []Rate
+	Version() int
+	// Returns the current rate set document along with the version it belongs to.
+	Snapshot() (Rates, int)
+	Find(id string) (Rate, bool)
+	// Replaces the whole rate set, assigning IDs to rates that are missing one.
+	// ifVersion must match the current version unless it is AnyVersion.
+	Set(set Rates, ifVersion int) (RateSetChange, error)
+	// Appends a single rate to the set and returns it with its assigned ID.
+	Add(rate Rate, ifVersion int) (Rate, RateSetChange, error)
+	// Applies update to the rate with the given id. The rate keeps its ID regardless of what update does.
+	Update(id string, ifVersion int, update func(*Rate) error) (Rate, RateSetChange, error)
+	Delete(id string, ifVersion int) (RateSetChange, error)
+	// Installs a rate set replicated from a leader at the leader's version, see RateSync.
+	Replicate(set Rates, version int) (RateSetChange, error)
 }
 
-func (store *RateStore) Get() []Rate {
+// RateStore held in memory, the zero value is an empty store ready to use.
+// With a backend every change is written through to it before it takes effect.
+type MemoryRateStore struct {
+	mu      sync.RWMutex
+	rates   []Rate
+	policy  string
+	charges []Charge
+	version int
+	backend RateBackend
+}
+
+// Loads the rate set saved in backend, an empty backend gives an empty store
+func NewBackedRateStore(backend RateBackend) (*MemoryRateStore, error) {
+	set, version, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryRateStore{
+		rates:   set.Rates,
+		policy:  set.Policy,
+		charges: set.Charges,
+		version: version,
+		backend: backend,
+	}, nil
+}
+
+// AnyVersion skips the optimistic concurrency check on store mutations.
+const AnyVersion = -1
+
+var (
+	errRateNotFound    = errors.New("rate not found")
+	errVersionMismatch = errors.New("rate set version mismatch")
+	errDuplicateRateID = errors.New("duplicate rate id")
+	errBadRateJSON     = errors.New("invalid rate json")
+	errRateStorage     = errors.New("rate storage failure")
+	// the backend was saved to by another instance, the write is retried after a reload
+	errStaleRates = errors.New("rate set changed in the backend")
+)
+
+func (store *MemoryRateStore) Get() []Rate {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
 	return store.rates
 }
 
-func (store *RateStore) Set(rates []Rate) {
-	store.rates = rates
+func (store *MemoryRateStore) Version() int {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.version
+}
+
+func (store *MemoryRateStore) Snapshot() (Rates, int) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.document(store.rates), store.version
 }
 
-func RateStoreFromFile(path string) (*RateStore, error) {
+func (store *MemoryRateStore) Find(id string) (Rate, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	i := indexOfRate(store.rates, id)
+	if i < 0 {
+		return Rate{}, false
+	}
+	return store.rates[i], true
+}
+
+func (store *MemoryRateStore) Set(set Rates, ifVersion int) (RateSetChange, error) {
+	next, err := withRateIDs(set.Rates)
+	if err != nil {
+		return RateSetChange{}, err
+	}
+	set.Rates = next
+
+	return store.write(func() (RateSetChange, error) {
+		if ifVersion != AnyVersion && ifVersion != store.version {
+			return RateSetChange{}, errVersionMismatch
+		}
+		return store.commit(set)
+	})
+}
+
+func (store *MemoryRateStore) Add(rate Rate, ifVersion int) (Rate, RateSetChange, error) {
+	if rate.ID == "" {
+		rate.ID = newRateID()
+	}
+
+	change, err := store.write(func() (RateSetChange, error) {
+		if ifVersion != AnyVersion && ifVersion != store.version {
+			return RateSetChange{}, errVersionMismatch
+		}
+		if indexOfRate(store.rates, rate.ID) >= 0 {
+			return RateSetChange{}, errDuplicateRateID
+		}
+		next := make([]Rate, len(store.rates), len(store.rates)+1)
+		copy(next, store.rates)
+		return store.commit(store.document(append(next, rate)))
+	})
+	if err != nil {
+		return Rate{}, RateSetChange{}, err
+	}
+	return rate, change, nil
+}
+
+// update may run more than once when another instance sharing the backend changed the rates first
+func (store *MemoryRateStore) Update(id string, ifVersion int, update func(*Rate) error) (Rate, RateSetChange, error) {
+	var rate Rate
+	change, err := store.write(func() (RateSetChange, error) {
+		if ifVersion != AnyVersion && ifVersion != store.version {
+			return RateSetChange{}, errVersionMismatch
+		}
+		i := indexOfRate(store.rates, id)
+		if i < 0 {
+			return RateSetChange{}, errRateNotFound
+		}
+
+		rate = store.rates[i]
+		err := update(&rate)
+		if err != nil {
+			return RateSetChange{}, err
+		}
+		rate.ID = id
+
+		next := make([]Rate, len(store.rates))
+		copy(next, store.rates)
+		next[i] = rate
+		return store.commit(store.document(next))
+	})
+	if err != nil {
+		return Rate{}, RateSetChange{}, err
+	}
+	return rate, change, nil
+}
+
+func (store *MemoryRateStore) Delete(id string, ifVersion int) (RateSetChange, error) {
+	return store.write(func() (RateSetChange, error) {
+		if ifVersion != AnyVersion && ifVersion != store.version {
+			return RateSetChange{}, errVersionMismatch
+		}
+		i := indexOfRate(store.rates, id)
+		if i < 0 {
+			return RateSetChange{}, errRateNotFound
+		}
+
+		next := make([]Rate, 0, len(store.rates)-1)
+		next = append(next, store.rates[:i]...)
+		return store.commit(store.document(append(next, store.rates[i+1:]...)))
+	})
+}
+
+// how many times a write is retried after another instance changed the shared backend under it
+const maxStaleRetries = 3
+
+// Runs apply under the write lock. When the backend holds a newer rate set than this instance,
+// it is loaded and apply runs again, so If-Match is checked against the rates actually stored.
+func (store *MemoryRateStore) write(apply func() (RateSetChange, error)) (RateSetChange, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for retries := 0; ; retries++ {
+		change, err := apply()
+		if err != errStaleRates {
+			return change, err
+		}
+		if retries == maxStaleRetries {
+			log.Printf("saving rates: backend kept changing after %d reloads", retries)
+			return RateSetChange{}, errRateStorage
+		}
+		err = store.reload()
+		if err != nil {
+			log.Printf("reloading rates: %v", err)
+			return RateSetChange{}, errRateStorage
+		}
+	}
+}
+
+// replaces the rate set with the one last saved to the backend, callers must hold the write lock
+func (store *MemoryRateStore) reload() error {
+	set, version, err := store.backend.Load()
+	if err != nil {
+		return err
+	}
+	store.rates = set.Rates
+	store.policy = set.Policy
+	store.charges = set.Charges
+	store.version = version
+	return nil
+}
+
+// Installs a rate set replicated from a leader at the leader's version.
+// Replicas keep it in memory only, the backend is left to the leader.
+func (store *MemoryRateStore) Replicate(set Rates, version int) (RateSetChange, error) {
+	next, err := withRateIDs(set.Rates)
+	if err != nil {
+		return RateSetChange{}, err
+	}
+	set.Rates = next
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	change := RateSetChange{
+		PreviousVersion: store.version,
+		Version:         version,
+		Diff:            DiffRateSets(store.document(store.rates), set),
+	}
+	store.rates = next
+	store.policy = set.Policy
+	store.charges = set.Charges
+	store.version = version
+	return change, nil
+}
+
+// the rate set document for rates with the current set level settings, callers must hold the lock
+func (store *MemoryRateStore) document(rates []Rate) Rates {
+	return Rates{Rates: rates, Policy: store.policy, Charges: store.charges}
+}
+
+// saves next to the backend and swaps it in as the active rate set, callers must hold the write lock
+func (store *MemoryRateStore) commit(next Rates) (RateSetChange, error) {
+	change := RateSetChange{
+		PreviousVersion: store.version,
+		Version:         store.version + 1,
+		Diff:            DiffRateSets(store.document(store.rates), next),
+	}
+	if store.backend != nil {
+		err := store.backend.Save(next, change.Version)
+		if err == errVersionMismatch {
+			return RateSetChange{}, errStaleRates
+		}
+		if err != nil {
+			log.Printf("saving rates version %d: %v", change.Version, err)
+			return RateSetChange{}, errRateStorage
+		}
+	}
+	store.rates = next.Rates
+	store.policy = next.Policy
+	store.charges = next.Charges
+	store.version = change.Version
+	return change, nil
+}
+
+func RateStoreFromFile(path string) (*MemoryRateStore, error) {
 	file, err := ioutil.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -144,12 +608,57 @@ func RateStoreFromFile(path string) (*RateStore, error) {
 	if err != nil {
 		return nil, err
 	}
-	store := &RateStore{
-		rates: rates.Rates,
+	err = resolveCalendars(rates.Rates, filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	errs := rates.Validate()
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	store := &MemoryRateStore{}
+	_, err = store.Set(rates, AnyVersion)
+	if err != nil {
+		return nil, err
 	}
 	return store, nil
 }
 
+func indexOfRate(rates []Rate, id string) int {
+	for i, v := range rates {
+		if v.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// returns a copy of rates where every rate has a unique ID
+func withRateIDs(rates []Rate) ([]Rate, error) {
+	out := make([]Rate, len(rates))
+	seen := make(map[string]bool, len(rates))
+	for i, v := range rates {
+		if v.ID == "" {
+			v.ID = newRateID()
+		}
+		if seen[v.ID] {
+			return nil, errDuplicateRateID
+		}
+		seen[v.ID] = true
+		out[i] = v
+	}
+	return out, nil
+}
+
+func newRateID() string {
+	b := make([]byte, 8)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
 func IntContains(ints []int, toFind int) bool {
 	for _, v := range ints {
 		if v == toFind {
@@ -169,6 +678,7 @@ type Metrics struct {
 }
 
 type MetricsStore struct {
+	mu      sync.Mutex
 	metrics map[string]Metrics
 	allKey  string
 }
@@ -189,13 +699,27 @@ func (_ *MetricsStore) getKey(method, path string) string {
 	return fmt.Sprintf("%s|%s", method, path)
 }
 
+// Returns a copy of the metrics, safe to read while requests are still being recorded
 func (store *MetricsStore) Get() EndpointMetrics {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	out := make(map[string]Metrics, len(store.metrics))
+	for k, v := range store.metrics {
+		counts := make(map[int]int, len(v.StatusCodeCount))
+		for code, count := range v.StatusCodeCount {
+			counts[code] = count
+		}
+		v.StatusCodeCount = counts
+		out[k] = v
+	}
 	return EndpointMetrics{
-		Metrics: store.metrics,
+		Metrics: out,
 	}
 }
 
 func (store *MetricsStore) Record(method, path string, statusCode, responseMs int) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
 	allMetrics, _ := store.metrics[store.allKey]
 	allMetrics.RequestCount++
 	allMetrics.AvgResponseTime = allMetrics.AvgResponseTime + (responseMs-allMetrics.AvgResponseTime)/allMetrics.RequestCount
@@ -218,22 +742,3 @@ func (store *MetricsStore) Record(method, path string, statusCode, responseMs in
 	v.StatusCodeCount[statusCode]++
 	store.metrics[mKey] = v
 }
-
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
-
-func webError(w http.ResponseWriter, statusCode int, msg string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	res := ErrorResponse{
-		Error: msg,
-	}
-	json.NewEncoder(w).Encode(res)
-}
-
-var (
-	ErrMissingBody = "Missing required body"
-	ErrBadBody     = "Error parsing json"
-	ErrInternal    = "There was an internal server error"
-)
@@ -0,0 +1,64 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// The published api description, TestOpenAPIRoutes fails when the routes in httpRoutes drift from it
+//
+//go:embed docs/openapi.json
+var openAPISpec []byte
+
+// Renders openAPISpec in the browser without any external assets
+//
+//go:embed docs/index.html
+var docsPage []byte
+
+type OpenAPIController struct {
+	Handler
+}
+
+func NewOpenAPIController() *OpenAPIController {
+	controller := OpenAPIController{
+		Handler: Handler{},
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetSpec)
+	return &controller
+}
+
+// GetSpec - Gets the OpenAPI 3 document describing this api.
+// @Summary Gets the OpenAPI 3 document describing this api.
+// @Description Gets the OpenAPI 3 document describing this api, /docs renders it.
+// @Tags docs
+// @Produce json
+// @Success 200 ""
+// @Router /openapi.json [get]
+func (c *OpenAPIController) GetSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+type DocsController struct {
+	Handler
+}
+
+func NewDocsController() *DocsController {
+	controller := DocsController{
+		Handler: Handler{},
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetDocs)
+	return &controller
+}
+
+// GetDocs - Browsable api docs.
+// @Summary Browsable api docs.
+// @Description A page listing every operation in /openapi.json that can also send requests.
+// @Tags docs
+// @Produce html
+// @Success 200 ""
+// @Router /docs [get]
+func (c *DocsController) GetDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(docsPage)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Pricing models, a rate without a pricing model charges its flat Price
+const (
+	PricingFlat         = "flat"
+	PricingPerIncrement = "per-increment"
+	PricingFirstHour    = "first-hour"
+)
+
+// Rounding rules for partially used increments
+const (
+	RoundUp      = "up"
+	RoundDown    = "down"
+	RoundNearest = "nearest"
+)
+
+/*
+Example Pricing, $3.00 per started hour capped at $20.00:
+
+	{
+		"model": "per-increment",
+		"incrementMinutes": 60,
+		"incrementPrice": 300,
+		"rounding": "up",
+		"maxPrice": 2000
+	}
+
+Example Pricing, $5.00 for the first hour then $3.00 per additional started half hour:
+
+	{
+		"model": "first-hour",
+		"firstHourPrice": 500,
+		"incrementMinutes": 30,
+		"incrementPrice": 300
+	}
+
+IncrementMinutes defaults to 60, pricing per hour.
+*/
+type Pricing struct {
+	Model            string `json:"model"`
+	IncrementMinutes int    `json:"incrementMinutes,omitempty"`
+	IncrementPrice   int    `json:"incrementPrice,omitempty"`
+	FirstHourPrice   int    `json:"firstHourPrice,omitempty"`
+	Rounding         string `json:"rounding,omitempty"`
+	MaxPrice         int    `json:"maxPrice,omitempty"`
+}
+
+func (p *Pricing) Validate() error {
+	if p.Model == "" || p.Model == PricingFlat {
+		return nil
+	}
+	if p.Model != PricingPerIncrement && p.Model != PricingFirstHour {
+		return fmt.Errorf("Invalid 'pricing.model' %q", p.Model)
+	}
+	if p.IncrementMinutes < 0 {
+		return errors.New("'pricing.incrementMinutes' must not be negative")
+	}
+	if p.IncrementPrice < 0 || p.FirstHourPrice < 0 || p.MaxPrice < 0 {
+		return errors.New("'pricing' prices must not be negative")
+	}
+	if p.Rounding != "" && p.Rounding != RoundUp && p.Rounding != RoundDown && p.Rounding != RoundNearest {
+		return fmt.Errorf("Invalid 'pricing.rounding' %q", p.Rounding)
+	}
+	return nil
+}
+
+// Returns the price of parking for duration under this rate.
+// Incremental models always charge at least the first hour or one increment and are capped by MaxPrice when set.
+func (r Rate) PriceFor(duration time.Duration) int {
+	p := r.Pricing
+	if p == nil || p.Model == "" || p.Model == PricingFlat {
+		return r.Price
+	}
+
+	price := 0
+	switch p.Model {
+	case PricingPerIncrement:
+		price = increments(duration, p, 1) * p.IncrementPrice
+	case PricingFirstHour:
+		price = p.FirstHourPrice
+		if duration > time.Hour {
+			// the first hour is the minimum, so rounding down may leave the rest uncharged
+			price += increments(duration-time.Hour, p, 0) * p.IncrementPrice
+		}
+	}
+
+	if p.MaxPrice > 0 && price > p.MaxPrice {
+		price = p.MaxPrice
+	}
+	return price
+}
+
+// number of increments to charge for duration, never less than minimum
+func increments(duration time.Duration, p *Pricing, minimum int) int {
+	increment := p.IncrementMinutes
+	if increment == 0 {
+		increment = 60
+	}
+	units := duration.Minutes() / float64(increment)
+	switch p.Rounding {
+	case RoundDown:
+		units = math.Floor(units)
+	case RoundNearest:
+		units = math.Round(units)
+	default:
+		units = math.Ceil(units)
+	}
+	if int(units) < minimum {
+		return minimum
+	}
+	return int(units)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// A documented error, Code is stable for clients to match on while Title may be reworded
+type ErrorCode struct {
+	Code   string
+	Status int
+	Title  string
+}
+
+var (
+	ErrMissingBody   = ErrorCode{"missing-body", http.StatusBadRequest, "Missing required body"}
+	ErrBadBody       = ErrorCode{"malformed-json", http.StatusBadRequest, "Error parsing json"}
+	ErrBadQuery      = ErrorCode{"invalid-query", http.StatusBadRequest, "Invalid query parameter"}
+	ErrInvalidBody   = ErrorCode{"schema-mismatch", http.StatusUnprocessableEntity, "Body does not match the api schema"}
+	ErrInvalidRate   = ErrorCode{"invalid-rate", http.StatusUnprocessableEntity, "Invalid rate"}
+	ErrInvalidSpan   = ErrorCode{"invalid-span", http.StatusUnprocessableEntity, "Invalid time range"}
+	ErrInvalidPromo  = ErrorCode{"invalid-promo", http.StatusUnprocessableEntity, "Invalid promo code"}
+	ErrInvalidSurge  = ErrorCode{"invalid-surge", http.StatusUnprocessableEntity, "Invalid surge factor"}
+	ErrRateData      = ErrorCode{"rate-data", http.StatusInternalServerError, "A stored rate could not be evaluated"}
+	ErrInternal      = ErrorCode{"internal", http.StatusInternalServerError, "There was an internal server error"}
+	ErrRouteNotFound = ErrorCode{"not-found", http.StatusNotFound, "Not found"}
+	ErrNotFound      = ErrorCode{"rate-not-found", http.StatusNotFound, "Rate not found"}
+	ErrConflict      = ErrorCode{"rate-id-conflict", http.StatusConflict, "Rate id already exists"}
+	ErrPrecondition  = ErrorCode{"version-mismatch", http.StatusPreconditionFailed, "Rates have changed since the provided If-Match version"}
+	ErrUnauthorized  = ErrorCode{"unauthorized", http.StatusUnauthorized, "Missing or invalid admin token"}
+	ErrPromoNotFound = ErrorCode{"promo-not-found", http.StatusNotFound, "Promo code not found"}
+	ErrPromoExists   = ErrorCode{"promo-exists", http.StatusConflict, "Promo code already exists"}
+	ErrPromoUsedUp   = ErrorCode{"promo-used-up", http.StatusConflict, "Promo code usage limit reached"}
+	ErrUnavailable   = ErrorCode{"unavailable", http.StatusConflict, "No rate is available for the requested span"}
+	ErrCapacityFull  = ErrorCode{"capacity-full", http.StatusConflict, "The facility is at capacity for the requested span"}
+
+	ErrReservationNotFound = ErrorCode{"reservation-not-found", http.StatusNotFound, "Reservation not found"}
+	ErrReadOnlyReplica     = ErrorCode{"read-only-replica", http.StatusForbidden, "Rates are read only on follower replicas, send changes to the leader"}
+	ErrMethodNotAllowed    = ErrorCode{"method-not-allowed", http.StatusMethodNotAllowed, "Method not allowed"}
+	ErrUnsupportedMedia    = ErrorCode{"unsupported-media-type", http.StatusUnsupportedMediaType, "Unsupported content type"}
+	ErrBodyTooLarge        = ErrorCode{"body-too-large", http.StatusRequestEntityTooLarge, "Request body too large"}
+)
+
+// Every ErrorCode the api answers with, keyed by Code
+var errorCatalog = map[string]ErrorCode{}
+
+func init() {
+	for _, v := range []ErrorCode{
+		ErrMissingBody, ErrBadBody, ErrBadQuery, ErrInvalidBody, ErrInvalidRate, ErrInvalidSpan, ErrInvalidPromo,
+		ErrInvalidSurge, ErrRateData, ErrInternal, ErrRouteNotFound, ErrNotFound, ErrConflict, ErrPrecondition,
+		ErrUnauthorized, ErrPromoNotFound, ErrPromoExists, ErrPromoUsedUp, ErrUnavailable, ErrCapacityFull,
+		ErrReservationNotFound, ErrReadOnlyReplica, ErrMethodNotAllowed, ErrUnsupportedMedia,
+		ErrBodyTooLarge,
+	} {
+		errorCatalog[v.Code] = v
+	}
+}
+
+// The error codes in the catalog, sorted
+func errorCodes() []string {
+	out := make([]string, 0, len(errorCatalog))
+	for k := range errorCatalog {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// problemTypePrefix + Code is the RFC 7807 type of every problem
+const problemTypePrefix = "urn:rate-api:error:"
+
+/*
+RFC 7807 error body, served as application/problem+json:
+
+	{
+		"type": "urn:rate-api:error:schema-mismatch",
+		"title": "Body does not match the api schema",
+		"status": 422,
+		"detail": "/endDate must not be before startDate",
+		"instance": "/quote",
+		"code": "schema-mismatch",
+		"requestId": "9f2c4e1a7b3d5068",
+		"errors": [{"pointer": "/endDate", "detail": "must not be before startDate"}]
+	}
+
+Detail carries the cause when there is one, Errors the fields at fault.
+*/
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func webError(w http.ResponseWriter, r *http.Request, code ErrorCode, detail string) {
+	writeProblem(w, r, code, detail, nil)
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, code ErrorCode, detail string, errs []FieldError) {
+	if detail == "" && len(errs) > 0 {
+		detail = errs[0].Pointer + " " + errs[0].Detail
+	}
+	problem := Problem{
+		Type:      problemTypePrefix + code.Code,
+		Title:     code.Title,
+		Status:    code.Status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code.Code,
+		RequestID: requestIDFromRequest(r),
+		Errors:    errs,
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(code.Status)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+Example Promo, 20% off weekday daytime parking during July capped at 500 redemptions:
+
+	{
+		"code": "SUMMER20",
+		"percentOff": 20,
+		"validFrom": "2015-07-01T00:00:00-05:00",
+		"validUntil": "2015-07-31T23:59:59-05:00",
+		"maxUses": 500,
+		"days": "mon-fri",
+		"times": "0600-1800",
+		"tz": "America/Chicago"
+	}
+
+Exactly one of PercentOff or AmountOff is set. Validity is checked against the time of quoting,
+while Days / Times restrict the parked span the same way a Rate does.
+*/
+type Promo struct {
+	Code       string       `json:"code"`
+	PercentOff int          `json:"percentOff,omitempty"`
+	AmountOff  int          `json:"amountOff,omitempty"`
+	ValidFrom  *ISO8601Time `json:"validFrom,omitempty"`
+	ValidUntil *ISO8601Time `json:"validUntil,omitempty"`
+	MaxUses    int          `json:"maxUses,omitempty"`
+	Uses       int          `json:"uses"`
+	Days       string       `json:"days,omitempty"`
+	Times      string       `json:"times,omitempty"`
+	Timezone   string       `json:"tz,omitempty"`
+}
+
+type Promos struct {
+	Promos []Promo `json:"promos"`
+}
+
+// Reasons a promo code was not applied to a quote
+const (
+	PromoUnknown    = "unknown-code"
+	PromoNotYet     = "not-yet-valid"
+	PromoExpired    = "expired"
+	PromoUsedUp     = "usage-limit-reached"
+	PromoNotAllowed = "span-not-eligible"
+)
+
+var (
+	errPromoNotFound = errors.New("promo not found")
+	errPromoExists   = errors.New("promo code already exists")
+	errPromoUsedUp   = errors.New("promo usage limit reached")
+)
+
+func (p Promo) Validate() error {
+	if strings.TrimSpace(p.Code) == "" || strings.Contains(p.Code, "/") {
+		return errors.New("'code' is required and must not contain '/'")
+	}
+	if (p.PercentOff == 0) == (p.AmountOff == 0) {
+		return errors.New("exactly one of 'percentOff' or 'amountOff' is required")
+	}
+	if p.PercentOff < 0 || p.PercentOff > 100 || p.AmountOff < 0 {
+		return errors.New("'percentOff' must be 1-100 and 'amountOff' must not be negative")
+	}
+	if p.MaxUses < 0 || p.Uses < 0 {
+		return errors.New("'maxUses' and 'uses' must not be negative")
+	}
+	if p.ValidFrom != nil && p.ValidUntil != nil && p.ValidUntil.Before(p.ValidFrom.Time) {
+		return errors.New("'validUntil' must not be before 'validFrom'")
+	}
+	if p.Days != "" || p.Times != "" {
+		return p.window().Validate()
+	}
+	return nil
+}
+
+// The promo's day / time restriction expressed as a rate so it can share rate matching
+func (p Promo) window() Rate {
+	window := Rate{
+		Days:     p.Days,
+		Times:    p.Times,
+		Timezone: p.Timezone,
+	}
+	if window.Days == "" {
+		window.Days = "daily"
+	}
+	if window.Times == "" {
+		window.Times = "0000-2400"
+	}
+	return window
+}
+
+// Returns why the promo can't be applied to the span at time now, or "" when it can
+func (p Promo) Check(start, end, now time.Time) string {
+	switch {
+	case p.ValidFrom != nil && now.Before(p.ValidFrom.Time):
+		return PromoNotYet
+	case p.ValidUntil != nil && now.After(p.ValidUntil.Time):
+		return PromoExpired
+	case p.MaxUses > 0 && p.Uses >= p.MaxUses:
+		return PromoUsedUp
+	}
+	if p.Days != "" || p.Times != "" {
+		matches, err := MatchRates([]Rate{p.window()}, start, end)
+		if err != nil || len(matches) == 0 {
+			return PromoNotAllowed
+		}
+	}
+	return ""
+}
+
+// Returns the amount taken off price, never more than price itself. Percentages round half up.
+func (p Promo) DiscountFor(price int) int {
+	discount := p.AmountOff
+	if p.PercentOff > 0 {
+		discount = (price*p.PercentOff + 50) / 100
+	}
+	if discount > price {
+		discount = price
+	}
+	return discount
+}
+
+// Store to manage promo codes, codes are case insensitive.
+// When a path is set every change, including redemptions, is written through to it so usage survives restarts.
+type PromoStore struct {
+	mu     sync.RWMutex
+	promos map[string]Promo
+	path   string
+}
+
+func NewPromoStore() *PromoStore {
+	return &PromoStore{
+		promos: map[string]Promo{},
+	}
+}
+
+// Loads promos from path and persists every later change to it
+func PromoStoreFromFile(path string) (*PromoStore, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var promos Promos
+	err = json.Unmarshal(file, &promos)
+	if err != nil {
+		return nil, err
+	}
+
+	store := NewPromoStore()
+	for _, v := range promos.Promos {
+		err = v.Validate()
+		if err == nil {
+			err = store.Add(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("promo %q: %v", v.Code, err)
+		}
+	}
+	store.path = path
+	return store, nil
+}
+
+func promoKey(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Returns every promo ordered by code
+func (store *PromoStore) List() []Promo {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.sorted()
+}
+
+// every promo ordered by code, caller must hold the lock
+func (store *PromoStore) sorted() []Promo {
+	out := make([]Promo, 0, len(store.promos))
+	for _, v := range store.promos {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Code < out[j].Code })
+	return out
+}
+
+// writes every promo to the store's file, caller must hold the lock
+func (store *PromoStore) save() error {
+	if store.path == "" {
+		return nil
+	}
+	out, err := json.MarshalIndent(Promos{Promos: store.sorted()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.path, out)
+}
+
+func (store *PromoStore) Find(code string) (Promo, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	promo, found := store.promos[promoKey(code)]
+	return promo, found
+}
+
+func (store *PromoStore) Add(promo Promo) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, found := store.promos[promoKey(promo.Code)]; found {
+		return errPromoExists
+	}
+	store.promos[promoKey(promo.Code)] = promo
+	err := store.save()
+	if err != nil {
+		delete(store.promos, promoKey(promo.Code))
+	}
+	return err
+}
+
+// Replaces the promo stored under code, its usage count is kept
+func (store *PromoStore) Put(code string, promo Promo) (Promo, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	existing, found := store.promos[promoKey(code)]
+	if !found {
+		return Promo{}, errPromoNotFound
+	}
+	promo.Code = existing.Code
+	promo.Uses = existing.Uses
+	store.promos[promoKey(code)] = promo
+	err := store.save()
+	if err != nil {
+		store.promos[promoKey(code)] = existing
+		return Promo{}, err
+	}
+	return promo, nil
+}
+
+func (store *PromoStore) Delete(code string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	existing, found := store.promos[promoKey(code)]
+	if !found {
+		return errPromoNotFound
+	}
+	delete(store.promos, promoKey(code))
+	err := store.save()
+	if err != nil {
+		store.promos[promoKey(code)] = existing
+	}
+	return err
+}
+
+// Counts a use of the promo, failing once its usage cap has been reached
+func (store *PromoStore) Redeem(code string) (Promo, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	promo, found := store.promos[promoKey(code)]
+	if !found {
+		return Promo{}, errPromoNotFound
+	}
+	if promo.MaxUses > 0 && promo.Uses >= promo.MaxUses {
+		return Promo{}, errPromoUsedUp
+	}
+	promo.Uses++
+	store.promos[promoKey(code)] = promo
+	err := store.save()
+	if err != nil {
+		promo.Uses--
+		store.promos[promoKey(code)] = promo
+		return Promo{}, err
+	}
+	return promo, nil
+}
+
+// Gives back a use counted by Redeem, for bookings that are cancelled or fail. Uses never drop below 0.
+func (store *PromoStore) Release(code string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	promo, found := store.promos[promoKey(code)]
+	if !found {
+		return errPromoNotFound
+	}
+	if promo.Uses == 0 {
+		return nil
+	}
+	promo.Uses--
+	store.promos[promoKey(code)] = promo
+	err := store.save()
+	if err != nil {
+		promo.Uses++
+		store.promos[promoKey(code)] = promo
+	}
+	return err
+}
+
+// Reports whether Apply took the quote's promo code off its price
+func promoApplied(quote Quote) bool {
+	return quote.Available && quote.PromoCode != "" && quote.PromoError == ""
+}
+
+// Applies the request's promo code to quote, an unusable code leaves the price untouched and sets PromoError
+func (store *PromoStore) Apply(quote *Quote, code string, now time.Time) {
+	if code == "" {
+		return
+	}
+	quote.PromoCode = code
+	promo, found := Promo{}, false
+	if store != nil {
+		promo, found = store.Find(code)
+	}
+	if !found {
+		quote.PromoError = PromoUnknown
+		return
+	}
+	if !quote.Available {
+		return
+	}
+	quote.PromoError = promo.Check(quote.StartDate.Time, quote.EndDate.Time, now)
+	if quote.PromoError != "" {
+		return
+	}
+	quote.Discount = promo.DiscountFor(quote.Price)
+	quote.Price -= quote.Discount
+}
+
+type PromosController struct {
+	Handler
+	Promos *PromoStore
+}
+
+func NewPromosController(store *PromoStore) *PromosController {
+	controller := PromosController{
+		Handler: Handler{},
+		Promos:  store,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetPromos)
+	controller.Handler[http.MethodPost] = http.HandlerFunc(controller.PostPromo)
+	return &controller
+}
+
+// GetPromos - Lists every promo code.
+// @Summary Lists every promo code.
+// @Description Lists every promo code along with its usage.
+// @Tags promos
+// @Produce json
+// @Success 200 {object} Promos
+// @Failure 401 {object} Problem
+// @Router /promos [get]
+func (c *PromosController) GetPromos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Promos{Promos: c.Promos.List()})
+}
+
+// PostPromo - Creates a promo code.
+// @Summary Creates a promo code.
+// @Description Creates a promo code.
+// @Tags promos
+// @Accept json
+// @Produce json
+// @Param Promo body Promo true "Promo"
+// @Success 201 {object} Promo
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 409 {object} Problem
+// @Router /promos [post]
+func (c *PromosController) PostPromo(w http.ResponseWriter, r *http.Request) {
+	promo, ok := decodePromo(w, r)
+	if !ok {
+		return
+	}
+	promo.Uses = 0
+	err := c.Promos.Add(promo)
+	if err != nil {
+		promoError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/promos/"+promo.Code)
+	writePromo(w, http.StatusCreated, promo)
+}
+
+// Serves /promos/{code} and /promos/{code}/redeem
+type PromoItemController struct {
+	Handler
+	Promos *PromoStore
+}
+
+func NewPromoItemController(store *PromoStore) *PromoItemController {
+	controller := PromoItemController{
+		Handler: Handler{},
+		Promos:  store,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetPromo)
+	controller.Handler[http.MethodPut] = http.HandlerFunc(controller.PutPromo)
+	controller.Handler[http.MethodDelete] = http.HandlerFunc(controller.DeletePromo)
+	controller.Handler[http.MethodPost] = http.HandlerFunc(controller.RedeemPromo)
+	return &controller
+}
+
+// GetPromo - Gets a single promo code.
+// @Summary Gets a single promo code.
+// @Description Gets a single promo code.
+// @Tags promos
+// @Produce json
+// @Param code path string true "Promo code"
+// @Success 200 {object} Promo
+// @Failure 401 {object} Problem
+// @Failure 404 {object} Problem
+// @Router /promos/{code} [get]
+func (c *PromoItemController) GetPromo(w http.ResponseWriter, r *http.Request) {
+	code, action := promoPath(r.URL.Path)
+	promo, found := c.Promos.Find(code)
+	if !found || action != "" {
+		webError(w, r, ErrPromoNotFound, "")
+		return
+	}
+	writePromo(w, http.StatusOK, promo)
+}
+
+// PutPromo - Replaces a promo code.
+// @Summary Replaces a promo code.
+// @Description Replaces a promo code's rules, its code and usage count are kept.
+// @Tags promos
+// @Accept json
+// @Produce json
+// @Param code path string true "Promo code"
+// @Param Promo body Promo true "Promo"
+// @Success 200 {object} Promo
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 401 {object} Problem
+// @Failure 404 {object} Problem
+// @Router /promos/{code} [put]
+func (c *PromoItemController) PutPromo(w http.ResponseWriter, r *http.Request) {
+	code, action := promoPath(r.URL.Path)
+	if action != "" {
+		webError(w, r, ErrPromoNotFound, "")
+		return
+	}
+	promo, ok := decodePromo(w, r)
+	if !ok {
+		return
+	}
+	promo, err := c.Promos.Put(code, promo)
+	if err != nil {
+		promoError(w, r, err)
+		return
+	}
+	writePromo(w, http.StatusOK, promo)
+}
+
+// DeletePromo - Removes a promo code.
+// @Summary Removes a promo code.
+// @Description Removes a promo code.
+// @Tags promos
+// @Param code path string true "Promo code"
+// @Success 204 ""
+// @Failure 401 {object} Problem
+// @Failure 404 {object} Problem
+// @Router /promos/{code} [delete]
+func (c *PromoItemController) DeletePromo(w http.ResponseWriter, r *http.Request) {
+	code, action := promoPath(r.URL.Path)
+	if action != "" {
+		webError(w, r, ErrPromoNotFound, "")
+		return
+	}
+	err := c.Promos.Delete(code)
+	if err != nil {
+		promoError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RedeemPromo - Counts a use of a promo code.
+// @Summary Counts a use of a promo code.
+// @Description Called at checkout to count a use of the code against its usage cap, quotes never count as a use.
+// @Tags promos
+// @Produce json
+// @Param code path string true "Promo code"
+// @Success 200 {object} Promo
+// @Failure 401 {object} Problem
+// @Failure 404 {object} Problem
+// @Failure 409 {object} Problem
+// @Router /promos/{code}/redeem [post]
+func (c *PromoItemController) RedeemPromo(w http.ResponseWriter, r *http.Request) {
+	code, action := promoPath(r.URL.Path)
+	if action != "redeem" {
+		webError(w, r, ErrPromoNotFound, "")
+		return
+	}
+	promo, err := c.Promos.Redeem(code)
+	if err != nil {
+		promoError(w, r, err)
+		return
+	}
+	writePromo(w, http.StatusOK, promo)
+}
+
+// splits /promos/{code}/{action} into its code and optional action
+func promoPath(path string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/promos/"), "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+func decodePromo(w http.ResponseWriter, r *http.Request) (Promo, bool) {
+	var promo Promo
+	if r.Body == nil {
+		webError(w, r, ErrMissingBody, "")
+		return promo, false
+	}
+	err := json.NewDecoder(r.Body).Decode(&promo)
+	if err != nil {
+		webError(w, r, ErrBadBody, err.Error())
+		return promo, false
+	}
+	if r.Method == http.MethodPut {
+		// the code comes from the path
+		promo.Code, _ = promoPath(r.URL.Path)
+	}
+	err = promo.Validate()
+	if err != nil {
+		webError(w, r, ErrInvalidPromo, err.Error())
+		return promo, false
+	}
+	return promo, true
+}
+
+func writePromo(w http.ResponseWriter, statusCode int, promo Promo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(promo)
+}
+
+func promoError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errPromoNotFound:
+		webError(w, r, ErrPromoNotFound, "")
+	case errPromoExists:
+		webError(w, r, ErrPromoExists, "")
+	case errPromoUsedUp:
+		webError(w, r, ErrPromoUsedUp, "")
+	default:
+		webError(w, r, ErrInternal, "")
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Conflict resolution policies for spans matched by more than one rate
+const (
+	PolicyFirstMatch   = "first-match"
+	PolicyLowestPrice  = "lowest-price"
+	PolicyHighestPrice = "highest-price"
+	PolicyPriority     = "priority"
+)
+
+var policies = []string{PolicyFirstMatch, PolicyLowestPrice, PolicyHighestPrice, PolicyPriority}
+
+// An empty policy is treated as first-match so existing rate files keep their behaviour
+func ValidatePolicy(policy string) error {
+	if policy == "" {
+		return nil
+	}
+	for _, v := range policies {
+		if v == policy {
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid 'policy' %q expected one of %v", policy, policies)
+}
+
+// Picks the winning rate out of matches, prices holds the computed price of each match.
+// Returns the position in matches of the winner, ties are always broken by slice order.
+func ResolveRate(rates []Rate, matches []int, prices []int, policy string) int {
+	winner := 0
+	for j := 1; j < len(matches); j++ {
+		switch policy {
+		case PolicyLowestPrice:
+			if prices[j] < prices[winner] {
+				winner = j
+			}
+		case PolicyHighestPrice:
+			if prices[j] > prices[winner] {
+				winner = j
+			}
+		case PolicyPriority:
+			if rates[matches[j]].Priority > rates[matches[winner]].Priority {
+				winner = j
+			}
+		}
+	}
+	return winner
+}
+
+// Detailed price for a span, Price is 0 when no rate is available
+type Quote struct {
+	StartDate      ISO8601Time `json:"startDate"`
+	EndDate        ISO8601Time `json:"endDate"`
+	Minutes        int         `json:"minutes"`
+	Available      bool        `json:"available"`
+	RateID         string      `json:"rateId,omitempty"`
+	Policy         string      `json:"policy"`
+	MatchedRateIDs []string    `json:"matchedRateIds"`
+	RateClass
+
+	// BasePrice is the winning rate's price, Price adds any surge adjustment and takes off any discount
+	// and Total adds the taxes and fees in LineItems on top of Price
+	BasePrice       int        `json:"basePrice"`
+	SurgeFactor     float64    `json:"surgeFactor,omitempty"`
+	SurgeAdjustment int        `json:"surgeAdjustment"`
+	Discount        int        `json:"discount"`
+	PromoCode       string     `json:"promoCode,omitempty"`
+	PromoError      string     `json:"promoError,omitempty"`
+	Price           int        `json:"price"`
+	LineItems       []LineItem `json:"lineItems"`
+	Total           int        `json:"total"`
+
+	// why the span is unavailable, one of the Reason constants
+	Reason     string          `json:"reason,omitempty"`
+	Rejections []RateRejection `json:"rejections,omitempty"`
+	Version    int             `json:"version"`
+	// signed quote token, only set when requested
+	Token string `json:"token,omitempty"`
+}
+
+// Prices a request against a rate set, resolving overlapping rates with the set's policy.
+// Requests that fail Validate are returned as errors.
+func QuoteRate(set Rates, req RateRequest) (Quote, error) {
+	err := req.Validate()
+	if err != nil {
+		return Quote{}, err
+	}
+	start, end := req.StartDate.Time, req.EndDate.Time
+	quote := Quote{
+		RateClass:      req.RateClass,
+		StartDate:      ISO8601Time{start},
+		EndDate:        ISO8601Time{end},
+		Minutes:        int(math.Ceil(end.Sub(start).Minutes())),
+		Policy:         set.Policy,
+		MatchedRateIDs: []string{},
+	}
+	if quote.Policy == "" {
+		quote.Policy = PolicyFirstMatch
+	}
+
+	matches, rejections, err := matchRates(set.Rates, start, end, req.RateClass)
+	if err != nil {
+		return quote, err
+	}
+	quote.Rejections = rejections
+	if len(matches) == 0 {
+		switch {
+		case start.UTC().YearDay() != end.UTC().YearDay() || start.UTC().Year() != end.UTC().Year():
+			quote.Reason = ReasonMultipleDays
+		case len(rejections) > 0:
+			quote.Reason = rejections[0].Reason
+		default:
+			quote.Reason = ReasonNoRate
+		}
+		return quote, nil
+	}
+	prices := make([]int, len(matches))
+	for j, i := range matches {
+		quote.MatchedRateIDs = append(quote.MatchedRateIDs, rateLabel(set.Rates, i))
+		prices[j] = set.Rates[i].PriceFor(end.Sub(start))
+	}
+
+	winner := ResolveRate(set.Rates, matches, prices, quote.Policy)
+	quote.BasePrice = prices[winner]
+	quote.Price = prices[winner]
+	quote.Available = true
+	quote.RateID = set.Rates[matches[winner]].ID
+	return quote, nil
+}
+
+// Builds quotes for the api from the active rates plus the optional pricing layers
+type Quoter struct {
+	Rates  RateStore
+	Promos *PromoStore
+	Surge  *SurgeStore
+}
+
+func NewQuoter(rates RateStore, promos *PromoStore, surge *SurgeStore) *Quoter {
+	return &Quoter{
+		Rates:  rates,
+		Promos: promos,
+		Surge:  surge,
+	}
+}
+
+func (q *Quoter) Quote(req RateRequest) (Quote, error) {
+	set, version := q.Rates.Snapshot()
+	return q.quote(set, version, req)
+}
+
+// Quotes every request against the same rate set version
+func (q *Quoter) QuoteBatch(reqs []RateRequest) ([]Quote, error) {
+	set, version := q.Rates.Snapshot()
+	out := make([]Quote, 0, len(reqs))
+	for _, v := range reqs {
+		quote, err := q.quote(set, version, v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, quote)
+	}
+	return out, nil
+}
+
+func (q *Quoter) quote(set Rates, version int, req RateRequest) (Quote, error) {
+	quote, err := QuoteRate(set, req)
+	if err != nil {
+		return quote, err
+	}
+	quote.Version = version
+	q.Surge.Apply(&quote, set.Rates)
+	q.Promos.Apply(&quote, req.PromoCode, time.Now())
+	ApplyCharges(&quote, set.Charges)
+	return quote, nil
+}
+
+type QuoteController struct {
+	Handler
+	Quoter *Quoter
+	Signer *QuoteSigner
+}
+
+func NewQuoteController(quoter *Quoter, signer *QuoteSigner) *QuoteController {
+	controller := QuoteController{
+		Handler: Handler{},
+		Quoter:  quoter,
+		Signer:  signer,
+	}
+	controller.Handler[http.MethodPost] = http.HandlerFunc(controller.PostQuote)
+	return &controller
+}
+
+// PostQuote - Given the time range input this returns a detailed quote.
+// @Summary Given the time range input this returns a detailed quote.
+// @Description Returns the price along with the rate that won, every rate that matched and the policy used to pick between them.
+// @Description Surge enabled rates follow the current surge factor, the quote shows the base price and the surge adjustment.
+// @Description An optional promoCode is applied on top, the quote shows the price before and after the discount.
+// @Description Taxes and fees from the rate set are listed as line items and added into the total.
+// @Description With token=true available quotes include a signed token, see /quote/verify.
+// @Tags rates
+// @Accept json
+// @Produce json
+// @Param RateRequest body RateRequest true "Time range"
+// @Param token query bool false "Include a signed quote token"
+// @Success 200 {object} Quote
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 404 ""
+// @Failure 500 {object} Problem
+// @Router /quote [post]
+func (c *QuoteController) PostQuote(w http.ResponseWriter, r *http.Request) {
+	var req RateRequest
+	if r.Body == nil {
+		webError(w, r, ErrMissingBody, "")
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		webError(w, r, ErrBadBody, err.Error())
+		return
+	}
+	err = req.Validate()
+	if err != nil {
+		webError(w, r, ErrInvalidSpan, err.Error())
+		return
+	}
+
+	quote, err := c.Quoter.Quote(req)
+	if err != nil {
+		webError(w, r, ErrRateData, err.Error())
+		return
+	}
+	if quote.Available && wantsToken(r) {
+		quote.Token, err = c.Signer.Sign(quote, time.Now())
+		if err != nil {
+			webError(w, r, ErrInternal, "")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A span booked at a locked price, Quote is the quote it was made from and
+// its Version is the rate set version the price was locked at.
+// Secret is handed to whoever made the booking, reading or cancelling it takes the secret.
+type Reservation struct {
+	ID        string    `json:"id"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"createdAt"`
+	Quote     Quote     `json:"quote"`
+}
+
+// header carrying the secret of the reservation being read or cancelled
+const reservationSecretHeader = "X-Reservation-Secret"
+
+// Reports whether secret is the reservation's, reservations without a secret match nothing
+func (r Reservation) ownedBy(secret string) bool {
+	return r.Secret != "" && subtle.ConstantTimeCompare([]byte(r.Secret), []byte(secret)) == 1
+}
+
+func newReservationSecret() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (r Reservation) overlaps(start, end time.Time) bool {
+	return r.Quote.StartDate.Before(end) && start.Before(r.Quote.EndDate.Time)
+}
+
+// reservations store errors, mapped to http responses by reservationError
+var (
+	errReservationNotFound = errors.New("reservation not found")
+	errCapacityFull        = errors.New("facility capacity reached")
+)
+
+// Holds reservations in memory, safe for concurrent use.
+// When a path is set every change is written through to it so reservations survive restarts.
+type ReservationStore struct {
+	mu           sync.RWMutex
+	reservations map[string]Reservation
+	// maximum reservations overlapping at any moment, 0 is unlimited
+	capacity int
+	path     string
+}
+
+func NewReservationStore(capacity int) *ReservationStore {
+	return &ReservationStore{
+		reservations: map[string]Reservation{},
+		capacity:     capacity,
+	}
+}
+
+// Loads reservations from path when it exists and persists every later change to it
+func ReservationStoreFromFile(path string, capacity int) (*ReservationStore, error) {
+	store := NewReservationStore(capacity)
+	store.path = path
+	file, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var reservations []Reservation
+	err = json.Unmarshal(file, &reservations)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range reservations {
+		store.reservations[v.ID] = v
+	}
+	return store, nil
+}
+
+func (store *ReservationStore) Find(id string) (Reservation, bool) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	reservation, ok := store.reservations[id]
+	return reservation, ok
+}
+
+// Books an available quote, rejected when the span would take the facility over capacity
+func (store *ReservationStore) Create(quote Quote, now time.Time) (Reservation, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.capacity > 0 && store.peakOccupancy(quote.StartDate.Time, quote.EndDate.Time) >= store.capacity {
+		return Reservation{}, errCapacityFull
+	}
+	id := newRateID()
+	reservation := Reservation{
+		ID:        id,
+		Secret:    newReservationSecret(),
+		CreatedAt: now.UTC(),
+		Quote:     quote,
+	}
+	store.reservations[id] = reservation
+	err := store.save()
+	if err != nil {
+		delete(store.reservations, id)
+		return Reservation{}, err
+	}
+	return reservation, nil
+}
+
+// Removes a reservation and returns it
+func (store *ReservationStore) Delete(id string) (Reservation, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	reservation, ok := store.reservations[id]
+	if !ok {
+		return Reservation{}, errReservationNotFound
+	}
+	delete(store.reservations, id)
+	err := store.save()
+	if err != nil {
+		store.reservations[id] = reservation
+		return Reservation{}, err
+	}
+	return reservation, nil
+}
+
+// most reservations overlapping at any one moment of start-end, caller must hold the lock.
+// Occupancy only rises where a reservation starts so checking those instants is enough.
+func (store *ReservationStore) peakOccupancy(start, end time.Time) int {
+	var overlapping []Reservation
+	instants := []time.Time{start}
+	for _, v := range store.reservations {
+		if v.overlaps(start, end) {
+			overlapping = append(overlapping, v)
+			if v.Quote.StartDate.After(start) {
+				instants = append(instants, v.Quote.StartDate.Time)
+			}
+		}
+	}
+	peak := 0
+	for _, instant := range instants {
+		count := 0
+		for _, v := range overlapping {
+			if !v.Quote.StartDate.After(instant) && instant.Before(v.Quote.EndDate.Time) {
+				count++
+			}
+		}
+		if count > peak {
+			peak = count
+		}
+	}
+	return peak
+}
+
+// writes every reservation to the store's file, caller must hold the lock
+func (store *ReservationStore) save() error {
+	if store.path == "" {
+		return nil
+	}
+	reservations := make([]Reservation, 0, len(store.reservations))
+	for _, v := range store.reservations {
+		reservations = append(reservations, v)
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].CreatedAt.Before(reservations[j].CreatedAt)
+	})
+	out, err := json.MarshalIndent(reservations, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(store.path, out)
+}
+
+type ReservationsController struct {
+	Handler
+	Quoter       *Quoter
+	Reservations *ReservationStore
+}
+
+func NewReservationsController(quoter *Quoter, store *ReservationStore) *ReservationsController {
+	controller := ReservationsController{
+		Handler:      Handler{},
+		Quoter:       quoter,
+		Reservations: store,
+	}
+	controller.Handler[http.MethodPost] = http.HandlerFunc(controller.PostReservation)
+	return &controller
+}
+
+type ReservationItemController struct {
+	Handler
+	Reservations *ReservationStore
+	Promos       *PromoStore
+}
+
+func NewReservationItemController(store *ReservationStore, promos *PromoStore) *ReservationItemController {
+	controller := ReservationItemController{
+		Handler:      Handler{},
+		Reservations: store,
+		Promos:       promos,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetReservation)
+	controller.Handler[http.MethodDelete] = http.HandlerFunc(controller.DeleteReservation)
+	return &controller
+}
+
+// PostReservation - Reserves a span at its current price.
+// @Summary Reserves a span at its current price.
+// @Description Quotes the span like /quote and books it, the price is locked at the current rate set version.
+// @Description Fails with 409 when no rate is available or the facility is at capacity for any part of the span.
+// @Description A promo code that discounts the quote is redeemed, counting a use, and given back when the reservation is cancelled.
+// @Tags reservations
+// @Accept json
+// @Produce json
+// @Param RateRequest body RateRequest true "Time range"
+// @Success 201 {object} Reservation
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 409 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /reservations [post]
+func (c *ReservationsController) PostReservation(w http.ResponseWriter, r *http.Request) {
+	var req RateRequest
+	if r.Body == nil {
+		webError(w, r, ErrMissingBody, "")
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		webError(w, r, ErrBadBody, err.Error())
+		return
+	}
+	err = req.Validate()
+	if err != nil {
+		webError(w, r, ErrInvalidSpan, err.Error())
+		return
+	}
+
+	quote, err := c.Quoter.Quote(req)
+	if err != nil {
+		webError(w, r, ErrRateData, err.Error())
+		return
+	}
+	if !quote.Available {
+		webError(w, r, ErrUnavailable, "")
+		return
+	}
+	// the promo counts once it is booked, a failed booking gives the use back
+	if promoApplied(quote) {
+		_, err = c.Quoter.Promos.Redeem(quote.PromoCode)
+		if err != nil {
+			promoError(w, r, err)
+			return
+		}
+	}
+	reservation, err := c.Reservations.Create(quote, time.Now())
+	if err != nil {
+		if promoApplied(quote) {
+			c.Quoter.Promos.Release(quote.PromoCode)
+		}
+		reservationError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/reservations/"+reservation.ID)
+	writeReservation(w, http.StatusCreated, reservation)
+}
+
+// GetReservation - Gets a reservation.
+// @Summary Gets a reservation.
+// @Description Gets a reservation along with the quote its price was locked at.
+// @Description Needs the secret returned when it was made, without it the reservation is reported as not found.
+// @Tags reservations
+// @Produce json
+// @Param id path string true "Reservation ID"
+// @Param X-Reservation-Secret header string true "Secret returned when the reservation was made"
+// @Success 200 {object} Reservation
+// @Failure 404 {object} Problem
+// @Router /reservations/{id} [get]
+func (c *ReservationItemController) GetReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := c.find(r)
+	if !ok {
+		webError(w, r, ErrReservationNotFound, "")
+		return
+	}
+	writeReservation(w, http.StatusOK, reservation)
+}
+
+// DeleteReservation - Cancels a reservation.
+// @Summary Cancels a reservation.
+// @Description Cancels a reservation, freeing its capacity and the use of its promo code.
+// @Description Needs the secret returned when it was made, without it the reservation is reported as not found.
+// @Tags reservations
+// @Param id path string true "Reservation ID"
+// @Param X-Reservation-Secret header string true "Secret returned when the reservation was made"
+// @Success 204 ""
+// @Failure 404 {object} Problem
+// @Router /reservations/{id} [delete]
+func (c *ReservationItemController) DeleteReservation(w http.ResponseWriter, r *http.Request) {
+	reservation, ok := c.find(r)
+	if !ok {
+		webError(w, r, ErrReservationNotFound, "")
+		return
+	}
+	reservation, err := c.Reservations.Delete(reservation.ID)
+	if err != nil {
+		reservationError(w, r, err)
+		return
+	}
+	if promoApplied(reservation.Quote) {
+		// the promo may have been deleted since, there is nothing to give back then
+		c.Promos.Release(reservation.Quote.PromoCode)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// the reservation at r's path when r carries its secret, other people's reservations look missing
+func (c *ReservationItemController) find(r *http.Request) (Reservation, bool) {
+	reservation, ok := c.Reservations.Find(reservationIDFromPath(r.URL.Path))
+	if !ok || !reservation.ownedBy(r.Header.Get(reservationSecretHeader)) {
+		return Reservation{}, false
+	}
+	return reservation, true
+}
+
+func reservationIDFromPath(path string) string {
+	return strings.Trim(strings.TrimPrefix(path, "/reservations"), "/")
+}
+
+func writeReservation(w http.ResponseWriter, statusCode int, reservation Reservation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(reservation)
+}
+
+func reservationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errReservationNotFound:
+		webError(w, r, ErrReservationNotFound, "")
+	case errCapacityFull:
+		webError(w, r, ErrCapacityFull, "")
+	default:
+		webError(w, r, ErrInternal, "")
+	}
+}
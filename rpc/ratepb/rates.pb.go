@@ -0,0 +1,1105 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: rateapi/v1/rates.proto
+
+// gRPC api of the rate api, served on RATE_API_GRPC_PORT.
+// It shares the rate store, pricing and admin token with the http api,
+// prices are in minor units just like the json api.
+
+package ratepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetRateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Start         *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End           *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	PromoCode     string                 `protobuf:"bytes,3,opt,name=promo_code,json=promoCode,proto3" json:"promo_code,omitempty"`
+	Vehicle       string                 `protobuf:"bytes,4,opt,name=vehicle,proto3" json:"vehicle,omitempty"`
+	Product       string                 `protobuf:"bytes,5,opt,name=product,proto3" json:"product,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRateRequest) Reset() {
+	*x = GetRateRequest{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRateRequest) ProtoMessage() {}
+
+func (x *GetRateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRateRequest.ProtoReflect.Descriptor instead.
+func (*GetRateRequest) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetRateRequest) GetStart() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *GetRateRequest) GetEnd() *timestamppb.Timestamp {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *GetRateRequest) GetPromoCode() string {
+	if x != nil {
+		return x.PromoCode
+	}
+	return ""
+}
+
+func (x *GetRateRequest) GetVehicle() string {
+	if x != nil {
+		return x.Vehicle
+	}
+	return ""
+}
+
+func (x *GetRateRequest) GetProduct() string {
+	if x != nil {
+		return x.Product
+	}
+	return ""
+}
+
+type GetRateResponse struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Available bool                   `protobuf:"varint,1,opt,name=available,proto3" json:"available,omitempty"`
+	// the winning rate's id and why the span is unavailable when it is
+	RateId          string      `protobuf:"bytes,2,opt,name=rate_id,json=rateId,proto3" json:"rate_id,omitempty"`
+	Reason          string      `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	BasePrice       int64       `protobuf:"varint,4,opt,name=base_price,json=basePrice,proto3" json:"base_price,omitempty"`
+	SurgeAdjustment int64       `protobuf:"varint,5,opt,name=surge_adjustment,json=surgeAdjustment,proto3" json:"surge_adjustment,omitempty"`
+	Discount        int64       `protobuf:"varint,6,opt,name=discount,proto3" json:"discount,omitempty"`
+	PromoError      string      `protobuf:"bytes,7,opt,name=promo_error,json=promoError,proto3" json:"promo_error,omitempty"`
+	Price           int64       `protobuf:"varint,8,opt,name=price,proto3" json:"price,omitempty"`
+	LineItems       []*LineItem `protobuf:"bytes,9,rep,name=line_items,json=lineItems,proto3" json:"line_items,omitempty"`
+	Total           int64       `protobuf:"varint,10,opt,name=total,proto3" json:"total,omitempty"`
+	Version         int64       `protobuf:"varint,11,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *GetRateResponse) Reset() {
+	*x = GetRateResponse{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRateResponse) ProtoMessage() {}
+
+func (x *GetRateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRateResponse.ProtoReflect.Descriptor instead.
+func (*GetRateResponse) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetRateResponse) GetAvailable() bool {
+	if x != nil {
+		return x.Available
+	}
+	return false
+}
+
+func (x *GetRateResponse) GetRateId() string {
+	if x != nil {
+		return x.RateId
+	}
+	return ""
+}
+
+func (x *GetRateResponse) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *GetRateResponse) GetBasePrice() int64 {
+	if x != nil {
+		return x.BasePrice
+	}
+	return 0
+}
+
+func (x *GetRateResponse) GetSurgeAdjustment() int64 {
+	if x != nil {
+		return x.SurgeAdjustment
+	}
+	return 0
+}
+
+func (x *GetRateResponse) GetDiscount() int64 {
+	if x != nil {
+		return x.Discount
+	}
+	return 0
+}
+
+func (x *GetRateResponse) GetPromoError() string {
+	if x != nil {
+		return x.PromoError
+	}
+	return ""
+}
+
+func (x *GetRateResponse) GetPrice() int64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *GetRateResponse) GetLineItems() []*LineItem {
+	if x != nil {
+		return x.LineItems
+	}
+	return nil
+}
+
+func (x *GetRateResponse) GetTotal() int64 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *GetRateResponse) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type LineItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Amount        int64                  `protobuf:"varint,3,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LineItem) Reset() {
+	*x = LineItem{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LineItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LineItem) ProtoMessage() {}
+
+func (x *LineItem) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LineItem.ProtoReflect.Descriptor instead.
+func (*LineItem) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *LineItem) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *LineItem) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *LineItem) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+type BatchGetRateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Requests      []*GetRateRequest      `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetRateRequest) Reset() {
+	*x = BatchGetRateRequest{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetRateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetRateRequest) ProtoMessage() {}
+
+func (x *BatchGetRateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetRateRequest.ProtoReflect.Descriptor instead.
+func (*BatchGetRateRequest) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BatchGetRateRequest) GetRequests() []*GetRateRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+type BatchGetRateResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// in the same order as the requests
+	Responses     []*GetRateResponse `protobuf:"bytes,1,rep,name=responses,proto3" json:"responses,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BatchGetRateResponse) Reset() {
+	*x = BatchGetRateResponse{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchGetRateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchGetRateResponse) ProtoMessage() {}
+
+func (x *BatchGetRateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchGetRateResponse.ProtoReflect.Descriptor instead.
+func (*BatchGetRateResponse) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *BatchGetRateResponse) GetResponses() []*GetRateResponse {
+	if x != nil {
+		return x.Responses
+	}
+	return nil
+}
+
+type ListRatesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRatesRequest) Reset() {
+	*x = ListRatesRequest{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRatesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRatesRequest) ProtoMessage() {}
+
+func (x *ListRatesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRatesRequest.ProtoReflect.Descriptor instead.
+func (*ListRatesRequest) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{5}
+}
+
+type SetRatesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Rates *RateSet               `protobuf:"bytes,1,opt,name=rates,proto3" json:"rates,omitempty"`
+	// expected current version, the update is rejected with FAILED_PRECONDITION when it differs
+	IfVersion     *int64 `protobuf:"varint,2,opt,name=if_version,json=ifVersion,proto3,oneof" json:"if_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetRatesRequest) Reset() {
+	*x = SetRatesRequest{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetRatesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetRatesRequest) ProtoMessage() {}
+
+func (x *SetRatesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetRatesRequest.ProtoReflect.Descriptor instead.
+func (*SetRatesRequest) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SetRatesRequest) GetRates() *RateSet {
+	if x != nil {
+		return x.Rates
+	}
+	return nil
+}
+
+func (x *SetRatesRequest) GetIfVersion() int64 {
+	if x != nil && x.IfVersion != nil {
+		return *x.IfVersion
+	}
+	return 0
+}
+
+type WatchRatesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// version the client already has, nothing is sent until the rates change from it
+	SinceVersion  *int64 `protobuf:"varint,1,opt,name=since_version,json=sinceVersion,proto3,oneof" json:"since_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRatesRequest) Reset() {
+	*x = WatchRatesRequest{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRatesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRatesRequest) ProtoMessage() {}
+
+func (x *WatchRatesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRatesRequest.ProtoReflect.Descriptor instead.
+func (*WatchRatesRequest) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *WatchRatesRequest) GetSinceVersion() int64 {
+	if x != nil && x.SinceVersion != nil {
+		return *x.SinceVersion
+	}
+	return 0
+}
+
+type RateSet struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Rates   []*Rate                `protobuf:"bytes,1,rep,name=rates,proto3" json:"rates,omitempty"`
+	Policy  string                 `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	Charges []*Charge              `protobuf:"bytes,3,rep,name=charges,proto3" json:"charges,omitempty"`
+	// ignored by SetRates
+	Version       int64 `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RateSet) Reset() {
+	*x = RateSet{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RateSet) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RateSet) ProtoMessage() {}
+
+func (x *RateSet) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RateSet.ProtoReflect.Descriptor instead.
+func (*RateSet) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *RateSet) GetRates() []*Rate {
+	if x != nil {
+		return x.Rates
+	}
+	return nil
+}
+
+func (x *RateSet) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+func (x *RateSet) GetCharges() []*Charge {
+	if x != nil {
+		return x.Charges
+	}
+	return nil
+}
+
+func (x *RateSet) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type Rate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Price         int64                  `protobuf:"varint,2,opt,name=price,proto3" json:"price,omitempty"`
+	Tz            string                 `protobuf:"bytes,3,opt,name=tz,proto3" json:"tz,omitempty"`
+	Times         string                 `protobuf:"bytes,4,opt,name=times,proto3" json:"times,omitempty"`
+	Days          string                 `protobuf:"bytes,5,opt,name=days,proto3" json:"days,omitempty"`
+	Priority      int64                  `protobuf:"varint,6,opt,name=priority,proto3" json:"priority,omitempty"`
+	Pricing       *Pricing               `protobuf:"bytes,7,opt,name=pricing,proto3" json:"pricing,omitempty"`
+	Dates         []string               `protobuf:"bytes,8,rep,name=dates,proto3" json:"dates,omitempty"`
+	MinDuration   string                 `protobuf:"bytes,9,opt,name=min_duration,json=minDuration,proto3" json:"min_duration,omitempty"`
+	MaxDuration   string                 `protobuf:"bytes,10,opt,name=max_duration,json=maxDuration,proto3" json:"max_duration,omitempty"`
+	Vehicle       string                 `protobuf:"bytes,11,opt,name=vehicle,proto3" json:"vehicle,omitempty"`
+	Product       string                 `protobuf:"bytes,12,opt,name=product,proto3" json:"product,omitempty"`
+	Surge         *SurgeBounds           `protobuf:"bytes,13,opt,name=surge,proto3" json:"surge,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Rate) Reset() {
+	*x = Rate{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Rate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Rate) ProtoMessage() {}
+
+func (x *Rate) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Rate.ProtoReflect.Descriptor instead.
+func (*Rate) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Rate) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Rate) GetPrice() int64 {
+	if x != nil {
+		return x.Price
+	}
+	return 0
+}
+
+func (x *Rate) GetTz() string {
+	if x != nil {
+		return x.Tz
+	}
+	return ""
+}
+
+func (x *Rate) GetTimes() string {
+	if x != nil {
+		return x.Times
+	}
+	return ""
+}
+
+func (x *Rate) GetDays() string {
+	if x != nil {
+		return x.Days
+	}
+	return ""
+}
+
+func (x *Rate) GetPriority() int64 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *Rate) GetPricing() *Pricing {
+	if x != nil {
+		return x.Pricing
+	}
+	return nil
+}
+
+func (x *Rate) GetDates() []string {
+	if x != nil {
+		return x.Dates
+	}
+	return nil
+}
+
+func (x *Rate) GetMinDuration() string {
+	if x != nil {
+		return x.MinDuration
+	}
+	return ""
+}
+
+func (x *Rate) GetMaxDuration() string {
+	if x != nil {
+		return x.MaxDuration
+	}
+	return ""
+}
+
+func (x *Rate) GetVehicle() string {
+	if x != nil {
+		return x.Vehicle
+	}
+	return ""
+}
+
+func (x *Rate) GetProduct() string {
+	if x != nil {
+		return x.Product
+	}
+	return ""
+}
+
+func (x *Rate) GetSurge() *SurgeBounds {
+	if x != nil {
+		return x.Surge
+	}
+	return nil
+}
+
+type Pricing struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Model            string                 `protobuf:"bytes,1,opt,name=model,proto3" json:"model,omitempty"`
+	IncrementMinutes int64                  `protobuf:"varint,2,opt,name=increment_minutes,json=incrementMinutes,proto3" json:"increment_minutes,omitempty"`
+	IncrementPrice   int64                  `protobuf:"varint,3,opt,name=increment_price,json=incrementPrice,proto3" json:"increment_price,omitempty"`
+	FirstHourPrice   int64                  `protobuf:"varint,4,opt,name=first_hour_price,json=firstHourPrice,proto3" json:"first_hour_price,omitempty"`
+	Rounding         string                 `protobuf:"bytes,5,opt,name=rounding,proto3" json:"rounding,omitempty"`
+	MaxPrice         int64                  `protobuf:"varint,6,opt,name=max_price,json=maxPrice,proto3" json:"max_price,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Pricing) Reset() {
+	*x = Pricing{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Pricing) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Pricing) ProtoMessage() {}
+
+func (x *Pricing) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Pricing.ProtoReflect.Descriptor instead.
+func (*Pricing) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Pricing) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *Pricing) GetIncrementMinutes() int64 {
+	if x != nil {
+		return x.IncrementMinutes
+	}
+	return 0
+}
+
+func (x *Pricing) GetIncrementPrice() int64 {
+	if x != nil {
+		return x.IncrementPrice
+	}
+	return 0
+}
+
+func (x *Pricing) GetFirstHourPrice() int64 {
+	if x != nil {
+		return x.FirstHourPrice
+	}
+	return 0
+}
+
+func (x *Pricing) GetRounding() string {
+	if x != nil {
+		return x.Rounding
+	}
+	return ""
+}
+
+func (x *Pricing) GetMaxPrice() int64 {
+	if x != nil {
+		return x.MaxPrice
+	}
+	return 0
+}
+
+type SurgeBounds struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Floor         int64                  `protobuf:"varint,1,opt,name=floor,proto3" json:"floor,omitempty"`
+	Ceiling       int64                  `protobuf:"varint,2,opt,name=ceiling,proto3" json:"ceiling,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SurgeBounds) Reset() {
+	*x = SurgeBounds{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SurgeBounds) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SurgeBounds) ProtoMessage() {}
+
+func (x *SurgeBounds) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SurgeBounds.ProtoReflect.Descriptor instead.
+func (*SurgeBounds) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SurgeBounds) GetFloor() int64 {
+	if x != nil {
+		return x.Floor
+	}
+	return 0
+}
+
+func (x *SurgeBounds) GetCeiling() int64 {
+	if x != nil {
+		return x.Ceiling
+	}
+	return 0
+}
+
+type Charge struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Percent       float64                `protobuf:"fixed64,3,opt,name=percent,proto3" json:"percent,omitempty"`
+	Amount        int64                  `protobuf:"varint,4,opt,name=amount,proto3" json:"amount,omitempty"`
+	OnFees        bool                   `protobuf:"varint,5,opt,name=on_fees,json=onFees,proto3" json:"on_fees,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Charge) Reset() {
+	*x = Charge{}
+	mi := &file_rateapi_v1_rates_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Charge) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Charge) ProtoMessage() {}
+
+func (x *Charge) ProtoReflect() protoreflect.Message {
+	mi := &file_rateapi_v1_rates_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Charge.ProtoReflect.Descriptor instead.
+func (*Charge) Descriptor() ([]byte, []int) {
+	return file_rateapi_v1_rates_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Charge) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Charge) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Charge) GetPercent() float64 {
+	if x != nil {
+		return x.Percent
+	}
+	return 0
+}
+
+func (x *Charge) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *Charge) GetOnFees() bool {
+	if x != nil {
+		return x.OnFees
+	}
+	return false
+}
+
+var File_rateapi_v1_rates_proto protoreflect.FileDescriptor
+
+const file_rateapi_v1_rates_proto_rawDesc = "" +
+	"\n" +
+	"\x16rateapi/v1/rates.proto\x12\n" +
+	"rateapi.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc3\x01\n" +
+	"\x0eGetRateRequest\x120\n" +
+	"\x05start\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x05start\x12,\n" +
+	"\x03end\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x03end\x12\x1d\n" +
+	"\n" +
+	"promo_code\x18\x03 \x01(\tR\tpromoCode\x12\x18\n" +
+	"\avehicle\x18\x04 \x01(\tR\avehicle\x12\x18\n" +
+	"\aproduct\x18\x05 \x01(\tR\aproduct\"\xe2\x02\n" +
+	"\x0fGetRateResponse\x12\x1c\n" +
+	"\tavailable\x18\x01 \x01(\bR\tavailable\x12\x17\n" +
+	"\arate_id\x18\x02 \x01(\tR\x06rateId\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\x12\x1d\n" +
+	"\n" +
+	"base_price\x18\x04 \x01(\x03R\tbasePrice\x12)\n" +
+	"\x10surge_adjustment\x18\x05 \x01(\x03R\x0fsurgeAdjustment\x12\x1a\n" +
+	"\bdiscount\x18\x06 \x01(\x03R\bdiscount\x12\x1f\n" +
+	"\vpromo_error\x18\a \x01(\tR\n" +
+	"promoError\x12\x14\n" +
+	"\x05price\x18\b \x01(\x03R\x05price\x123\n" +
+	"\n" +
+	"line_items\x18\t \x03(\v2\x14.rateapi.v1.LineItemR\tlineItems\x12\x14\n" +
+	"\x05total\x18\n" +
+	" \x01(\x03R\x05total\x12\x18\n" +
+	"\aversion\x18\v \x01(\x03R\aversion\"J\n" +
+	"\bLineItem\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x16\n" +
+	"\x06amount\x18\x03 \x01(\x03R\x06amount\"M\n" +
+	"\x13BatchGetRateRequest\x126\n" +
+	"\brequests\x18\x01 \x03(\v2\x1a.rateapi.v1.GetRateRequestR\brequests\"Q\n" +
+	"\x14BatchGetRateResponse\x129\n" +
+	"\tresponses\x18\x01 \x03(\v2\x1b.rateapi.v1.GetRateResponseR\tresponses\"\x12\n" +
+	"\x10ListRatesRequest\"o\n" +
+	"\x0fSetRatesRequest\x12)\n" +
+	"\x05rates\x18\x01 \x01(\v2\x13.rateapi.v1.RateSetR\x05rates\x12\"\n" +
+	"\n" +
+	"if_version\x18\x02 \x01(\x03H\x00R\tifVersion\x88\x01\x01B\r\n" +
+	"\v_if_version\"O\n" +
+	"\x11WatchRatesRequest\x12(\n" +
+	"\rsince_version\x18\x01 \x01(\x03H\x00R\fsinceVersion\x88\x01\x01B\x10\n" +
+	"\x0e_since_version\"\x91\x01\n" +
+	"\aRateSet\x12&\n" +
+	"\x05rates\x18\x01 \x03(\v2\x10.rateapi.v1.RateR\x05rates\x12\x16\n" +
+	"\x06policy\x18\x02 \x01(\tR\x06policy\x12,\n" +
+	"\acharges\x18\x03 \x03(\v2\x12.rateapi.v1.ChargeR\acharges\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x03R\aversion\"\xf0\x02\n" +
+	"\x04Rate\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05price\x18\x02 \x01(\x03R\x05price\x12\x0e\n" +
+	"\x02tz\x18\x03 \x01(\tR\x02tz\x12\x14\n" +
+	"\x05times\x18\x04 \x01(\tR\x05times\x12\x12\n" +
+	"\x04days\x18\x05 \x01(\tR\x04days\x12\x1a\n" +
+	"\bpriority\x18\x06 \x01(\x03R\bpriority\x12-\n" +
+	"\apricing\x18\a \x01(\v2\x13.rateapi.v1.PricingR\apricing\x12\x14\n" +
+	"\x05dates\x18\b \x03(\tR\x05dates\x12!\n" +
+	"\fmin_duration\x18\t \x01(\tR\vminDuration\x12!\n" +
+	"\fmax_duration\x18\n" +
+	" \x01(\tR\vmaxDuration\x12\x18\n" +
+	"\avehicle\x18\v \x01(\tR\avehicle\x12\x18\n" +
+	"\aproduct\x18\f \x01(\tR\aproduct\x12-\n" +
+	"\x05surge\x18\r \x01(\v2\x17.rateapi.v1.SurgeBoundsR\x05surge\"\xd8\x01\n" +
+	"\aPricing\x12\x14\n" +
+	"\x05model\x18\x01 \x01(\tR\x05model\x12+\n" +
+	"\x11increment_minutes\x18\x02 \x01(\x03R\x10incrementMinutes\x12'\n" +
+	"\x0fincrement_price\x18\x03 \x01(\x03R\x0eincrementPrice\x12(\n" +
+	"\x10first_hour_price\x18\x04 \x01(\x03R\x0efirstHourPrice\x12\x1a\n" +
+	"\brounding\x18\x05 \x01(\tR\brounding\x12\x1b\n" +
+	"\tmax_price\x18\x06 \x01(\x03R\bmaxPrice\"=\n" +
+	"\vSurgeBounds\x12\x14\n" +
+	"\x05floor\x18\x01 \x01(\x03R\x05floor\x12\x18\n" +
+	"\aceiling\x18\x02 \x01(\x03R\aceiling\"{\n" +
+	"\x06Charge\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x18\n" +
+	"\apercent\x18\x03 \x01(\x01R\apercent\x12\x16\n" +
+	"\x06amount\x18\x04 \x01(\x03R\x06amount\x12\x17\n" +
+	"\aon_fees\x18\x05 \x01(\bR\x06onFees2\xe6\x02\n" +
+	"\vRateService\x12B\n" +
+	"\aGetRate\x12\x1a.rateapi.v1.GetRateRequest\x1a\x1b.rateapi.v1.GetRateResponse\x12Q\n" +
+	"\fBatchGetRate\x12\x1f.rateapi.v1.BatchGetRateRequest\x1a .rateapi.v1.BatchGetRateResponse\x12>\n" +
+	"\tListRates\x12\x1c.rateapi.v1.ListRatesRequest\x1a\x13.rateapi.v1.RateSet\x12<\n" +
+	"\bSetRates\x12\x1b.rateapi.v1.SetRatesRequest\x1a\x13.rateapi.v1.RateSet\x12B\n" +
+	"\n" +
+	"WatchRates\x12\x1d.rateapi.v1.WatchRatesRequest\x1a\x13.rateapi.v1.RateSet0\x01B1Z/github.com/Ashtonian/rate-api/rpc/ratepb;ratepbb\x06proto3"
+
+var (
+	file_rateapi_v1_rates_proto_rawDescOnce sync.Once
+	file_rateapi_v1_rates_proto_rawDescData []byte
+)
+
+func file_rateapi_v1_rates_proto_rawDescGZIP() []byte {
+	file_rateapi_v1_rates_proto_rawDescOnce.Do(func() {
+		file_rateapi_v1_rates_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_rateapi_v1_rates_proto_rawDesc), len(file_rateapi_v1_rates_proto_rawDesc)))
+	})
+	return file_rateapi_v1_rates_proto_rawDescData
+}
+
+var file_rateapi_v1_rates_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_rateapi_v1_rates_proto_goTypes = []any{
+	(*GetRateRequest)(nil),        // 0: rateapi.v1.GetRateRequest
+	(*GetRateResponse)(nil),       // 1: rateapi.v1.GetRateResponse
+	(*LineItem)(nil),              // 2: rateapi.v1.LineItem
+	(*BatchGetRateRequest)(nil),   // 3: rateapi.v1.BatchGetRateRequest
+	(*BatchGetRateResponse)(nil),  // 4: rateapi.v1.BatchGetRateResponse
+	(*ListRatesRequest)(nil),      // 5: rateapi.v1.ListRatesRequest
+	(*SetRatesRequest)(nil),       // 6: rateapi.v1.SetRatesRequest
+	(*WatchRatesRequest)(nil),     // 7: rateapi.v1.WatchRatesRequest
+	(*RateSet)(nil),               // 8: rateapi.v1.RateSet
+	(*Rate)(nil),                  // 9: rateapi.v1.Rate
+	(*Pricing)(nil),               // 10: rateapi.v1.Pricing
+	(*SurgeBounds)(nil),           // 11: rateapi.v1.SurgeBounds
+	(*Charge)(nil),                // 12: rateapi.v1.Charge
+	(*timestamppb.Timestamp)(nil), // 13: google.protobuf.Timestamp
+}
+var file_rateapi_v1_rates_proto_depIdxs = []int32{
+	13, // 0: rateapi.v1.GetRateRequest.start:type_name -> google.protobuf.Timestamp
+	13, // 1: rateapi.v1.GetRateRequest.end:type_name -> google.protobuf.Timestamp
+	2,  // 2: rateapi.v1.GetRateResponse.line_items:type_name -> rateapi.v1.LineItem
+	0,  // 3: rateapi.v1.BatchGetRateRequest.requests:type_name -> rateapi.v1.GetRateRequest
+	1,  // 4: rateapi.v1.BatchGetRateResponse.responses:type_name -> rateapi.v1.GetRateResponse
+	8,  // 5: rateapi.v1.SetRatesRequest.rates:type_name -> rateapi.v1.RateSet
+	9,  // 6: rateapi.v1.RateSet.rates:type_name -> rateapi.v1.Rate
+	12, // 7: rateapi.v1.RateSet.charges:type_name -> rateapi.v1.Charge
+	10, // 8: rateapi.v1.Rate.pricing:type_name -> rateapi.v1.Pricing
+	11, // 9: rateapi.v1.Rate.surge:type_name -> rateapi.v1.SurgeBounds
+	0,  // 10: rateapi.v1.RateService.GetRate:input_type -> rateapi.v1.GetRateRequest
+	3,  // 11: rateapi.v1.RateService.BatchGetRate:input_type -> rateapi.v1.BatchGetRateRequest
+	5,  // 12: rateapi.v1.RateService.ListRates:input_type -> rateapi.v1.ListRatesRequest
+	6,  // 13: rateapi.v1.RateService.SetRates:input_type -> rateapi.v1.SetRatesRequest
+	7,  // 14: rateapi.v1.RateService.WatchRates:input_type -> rateapi.v1.WatchRatesRequest
+	1,  // 15: rateapi.v1.RateService.GetRate:output_type -> rateapi.v1.GetRateResponse
+	4,  // 16: rateapi.v1.RateService.BatchGetRate:output_type -> rateapi.v1.BatchGetRateResponse
+	8,  // 17: rateapi.v1.RateService.ListRates:output_type -> rateapi.v1.RateSet
+	8,  // 18: rateapi.v1.RateService.SetRates:output_type -> rateapi.v1.RateSet
+	8,  // 19: rateapi.v1.RateService.WatchRates:output_type -> rateapi.v1.RateSet
+	15, // [15:20] is the sub-list for method output_type
+	10, // [10:15] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_rateapi_v1_rates_proto_init() }
+func file_rateapi_v1_rates_proto_init() {
+	if File_rateapi_v1_rates_proto != nil {
+		return
+	}
+	file_rateapi_v1_rates_proto_msgTypes[6].OneofWrappers = []any{}
+	file_rateapi_v1_rates_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_rateapi_v1_rates_proto_rawDesc), len(file_rateapi_v1_rates_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_rateapi_v1_rates_proto_goTypes,
+		DependencyIndexes: file_rateapi_v1_rates_proto_depIdxs,
+		MessageInfos:      file_rateapi_v1_rates_proto_msgTypes,
+	}.Build()
+	File_rateapi_v1_rates_proto = out.File
+	file_rateapi_v1_rates_proto_goTypes = nil
+	file_rateapi_v1_rates_proto_depIdxs = nil
+}
@@ -0,0 +1,291 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: rateapi/v1/rates.proto
+
+// gRPC api of the rate api, served on RATE_API_GRPC_PORT.
+// It shares the rate store, pricing and admin token with the http api,
+// prices are in minor units just like the json api.
+
+package ratepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RateService_GetRate_FullMethodName      = "/rateapi.v1.RateService/GetRate"
+	RateService_BatchGetRate_FullMethodName = "/rateapi.v1.RateService/BatchGetRate"
+	RateService_ListRates_FullMethodName    = "/rateapi.v1.RateService/ListRates"
+	RateService_SetRates_FullMethodName     = "/rateapi.v1.RateService/SetRates"
+	RateService_WatchRates_FullMethodName   = "/rateapi.v1.RateService/WatchRates"
+)
+
+// RateServiceClient is the client API for RateService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RateServiceClient interface {
+	// Prices a span, like POST /quote
+	GetRate(ctx context.Context, in *GetRateRequest, opts ...grpc.CallOption) (*GetRateResponse, error)
+	// Prices several spans against the same rate set version
+	BatchGetRate(ctx context.Context, in *BatchGetRateRequest, opts ...grpc.CallOption) (*BatchGetRateResponse, error)
+	// Returns the current rate set, like GET /rates
+	ListRates(ctx context.Context, in *ListRatesRequest, opts ...grpc.CallOption) (*RateSet, error)
+	// Replaces the rate set, like POST /rates with a "rates" body. Requires the admin token
+	SetRates(ctx context.Context, in *SetRatesRequest, opts ...grpc.CallOption) (*RateSet, error)
+	// Sends the current rate set then every change, like GET /rates/stream
+	WatchRates(ctx context.Context, in *WatchRatesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RateSet], error)
+}
+
+type rateServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRateServiceClient(cc grpc.ClientConnInterface) RateServiceClient {
+	return &rateServiceClient{cc}
+}
+
+func (c *rateServiceClient) GetRate(ctx context.Context, in *GetRateRequest, opts ...grpc.CallOption) (*GetRateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetRateResponse)
+	err := c.cc.Invoke(ctx, RateService_GetRate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateServiceClient) BatchGetRate(ctx context.Context, in *BatchGetRateRequest, opts ...grpc.CallOption) (*BatchGetRateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchGetRateResponse)
+	err := c.cc.Invoke(ctx, RateService_BatchGetRate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateServiceClient) ListRates(ctx context.Context, in *ListRatesRequest, opts ...grpc.CallOption) (*RateSet, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RateSet)
+	err := c.cc.Invoke(ctx, RateService_ListRates_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateServiceClient) SetRates(ctx context.Context, in *SetRatesRequest, opts ...grpc.CallOption) (*RateSet, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RateSet)
+	err := c.cc.Invoke(ctx, RateService_SetRates_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateServiceClient) WatchRates(ctx context.Context, in *WatchRatesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RateSet], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RateService_ServiceDesc.Streams[0], RateService_WatchRates_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRatesRequest, RateSet]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RateService_WatchRatesClient = grpc.ServerStreamingClient[RateSet]
+
+// RateServiceServer is the server API for RateService service.
+// All implementations must embed UnimplementedRateServiceServer
+// for forward compatibility.
+type RateServiceServer interface {
+	// Prices a span, like POST /quote
+	GetRate(context.Context, *GetRateRequest) (*GetRateResponse, error)
+	// Prices several spans against the same rate set version
+	BatchGetRate(context.Context, *BatchGetRateRequest) (*BatchGetRateResponse, error)
+	// Returns the current rate set, like GET /rates
+	ListRates(context.Context, *ListRatesRequest) (*RateSet, error)
+	// Replaces the rate set, like POST /rates with a "rates" body. Requires the admin token
+	SetRates(context.Context, *SetRatesRequest) (*RateSet, error)
+	// Sends the current rate set then every change, like GET /rates/stream
+	WatchRates(*WatchRatesRequest, grpc.ServerStreamingServer[RateSet]) error
+	mustEmbedUnimplementedRateServiceServer()
+}
+
+// UnimplementedRateServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRateServiceServer struct{}
+
+func (UnimplementedRateServiceServer) GetRate(context.Context, *GetRateRequest) (*GetRateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetRate not implemented")
+}
+func (UnimplementedRateServiceServer) BatchGetRate(context.Context, *BatchGetRateRequest) (*BatchGetRateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method BatchGetRate not implemented")
+}
+func (UnimplementedRateServiceServer) ListRates(context.Context, *ListRatesRequest) (*RateSet, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListRates not implemented")
+}
+func (UnimplementedRateServiceServer) SetRates(context.Context, *SetRatesRequest) (*RateSet, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetRates not implemented")
+}
+func (UnimplementedRateServiceServer) WatchRates(*WatchRatesRequest, grpc.ServerStreamingServer[RateSet]) error {
+	return status.Error(codes.Unimplemented, "method WatchRates not implemented")
+}
+func (UnimplementedRateServiceServer) mustEmbedUnimplementedRateServiceServer() {}
+func (UnimplementedRateServiceServer) testEmbeddedByValue()                     {}
+
+// UnsafeRateServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RateServiceServer will
+// result in compilation errors.
+type UnsafeRateServiceServer interface {
+	mustEmbedUnimplementedRateServiceServer()
+}
+
+func RegisterRateServiceServer(s grpc.ServiceRegistrar, srv RateServiceServer) {
+	// If the following call panics, it indicates UnimplementedRateServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RateService_ServiceDesc, srv)
+}
+
+func _RateService_GetRate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateServiceServer).GetRate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateService_GetRate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateServiceServer).GetRate(ctx, req.(*GetRateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateService_BatchGetRate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchGetRateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateServiceServer).BatchGetRate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateService_BatchGetRate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateServiceServer).BatchGetRate(ctx, req.(*BatchGetRateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateService_ListRates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateServiceServer).ListRates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateService_ListRates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateServiceServer).ListRates(ctx, req.(*ListRatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateService_SetRates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateServiceServer).SetRates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateService_SetRates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateServiceServer).SetRates(ctx, req.(*SetRatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateService_WatchRates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRatesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RateServiceServer).WatchRates(m, &grpc.GenericServerStream[WatchRatesRequest, RateSet]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RateService_WatchRatesServer = grpc.ServerStreamingServer[RateSet]
+
+// RateService_ServiceDesc is the grpc.ServiceDesc for RateService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RateService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rateapi.v1.RateService",
+	HandlerType: (*RateServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetRate",
+			Handler:    _RateService_GetRate_Handler,
+		},
+		{
+			MethodName: "BatchGetRate",
+			Handler:    _RateService_BatchGetRate_Handler,
+		},
+		{
+			MethodName: "ListRates",
+			Handler:    _RateService_ListRates_Handler,
+		},
+		{
+			MethodName: "SetRates",
+			Handler:    _RateService_SetRates_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRates",
+			Handler:       _RateService_WatchRates_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "rateapi/v1/rates.proto",
+}
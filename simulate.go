@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Price of a single historical request under the current and candidate rates.
+// Prices follow QuoteRate using each set's own policy, 0 means unavailable.
+type SimulationResult struct {
+	Request        RateRequest `json:"request"`
+	CurrentPrice   int         `json:"currentPrice"`
+	CandidatePrice int         `json:"candidatePrice"`
+	Delta          int         `json:"delta"`
+}
+
+type SimulationReport struct {
+	Requests         int                `json:"requests"`
+	Changed          int                `json:"changed"`
+	NewlyAvailable   int                `json:"newlyAvailable"`
+	NewlyUnavailable int                `json:"newlyUnavailable"`
+	CurrentRevenue   int                `json:"currentRevenue"`
+	CandidateRevenue int                `json:"candidateRevenue"`
+	RevenueDelta     int                `json:"revenueDelta"`
+	Results          []SimulationResult `json:"results"`
+}
+
+// Replays requests against both rate sets, only requests whose price changed are listed in Results.
+func Simulate(current, candidate Rates, requests []RateRequest) (SimulationReport, error) {
+	report := SimulationReport{
+		Requests: len(requests),
+		Results:  []SimulationResult{},
+	}
+	for _, v := range requests {
+		currentQuote, err := QuoteRate(current, v)
+		if err != nil {
+			return report, err
+		}
+		candidateQuote, err := QuoteRate(candidate, v)
+		if err != nil {
+			return report, err
+		}
+		currentPrice, candidatePrice := currentQuote.Price, candidateQuote.Price
+
+		report.CurrentRevenue += currentPrice
+		report.CandidateRevenue += candidatePrice
+		if currentPrice == candidatePrice {
+			continue
+		}
+
+		report.Changed++
+		if currentPrice == 0 {
+			report.NewlyAvailable++
+		}
+		if candidatePrice == 0 {
+			report.NewlyUnavailable++
+		}
+		report.Results = append(report.Results, SimulationResult{
+			Request:        v,
+			CurrentPrice:   currentPrice,
+			CandidatePrice: candidatePrice,
+			Delta:          candidatePrice - currentPrice,
+		})
+	}
+	report.RevenueDelta = report.CandidateRevenue - report.CurrentRevenue
+	return report, nil
+}
+
+// Reads a stream of RateRequest json objects, one per line (JSONL) or as a single json array.
+func ReadRateRequests(r io.Reader) ([]RateRequest, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	raw = bytes.TrimSpace(raw)
+
+	out := []RateRequest{}
+	if bytes.HasPrefix(raw, []byte("[")) {
+		err = json.Unmarshal(raw, &out)
+		return out, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	for decoder.More() {
+		var req RateRequest
+		err := decoder.Decode(&req)
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %v", len(out)+1, err)
+		}
+		out = append(out, req)
+	}
+	return out, nil
+}
+
+// rate-api simulate -requests past.jsonl -candidate candidate.json [-rates rates.json]
+func runSimulate(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	requestsPath := flags.String("requests", "", "file of past rate requests, JSONL or a json array")
+	candidatePath := flags.String("candidate", "", "candidate rates file")
+	currentPath := flags.String("rates", ratesPath(), "current rates file")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *requestsPath == "" || *candidatePath == "" {
+		flags.Usage()
+		return fmt.Errorf("-requests and -candidate are required")
+	}
+
+	current, err := RateStoreFromFile(*currentPath)
+	if err != nil {
+		return err
+	}
+	candidate, err := RateStoreFromFile(*candidatePath)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(*requestsPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	requests, err := ReadRateRequests(file)
+	if err != nil {
+		return err
+	}
+
+	currentSet, _ := current.Snapshot()
+	candidateSet, _ := candidate.Snapshot()
+	report, err := Simulate(currentSet, candidateSet, requests)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
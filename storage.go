@@ -0,0 +1,315 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	_ "modernc.org/sqlite"
+)
+
+// Rate store backends, picked with RATE_API_STORE
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+	StoreBolt   = "bolt"
+	StoreSQLite = "sqlite"
+)
+
+// Durable storage for a rate set, MemoryRateStore writes every change through to it.
+// Backends shared between instances reject a save with errVersionMismatch when the stored
+// version is not the one before version, another instance got there first. The store then
+// loads the newer set and retries the change on top of it.
+type RateBackend interface {
+	// Returns the saved rate set and its version, version 0 when nothing has been saved yet
+	Load() (Rates, int, error)
+	Save(set Rates, version int) error
+	Close() error
+}
+
+// how a rate set is stored by the file and bolt backends
+type storedRates struct {
+	Version int `json:"version"`
+	Rates
+}
+
+// Opens the rate store chosen by kind. Persistent stores that have never been saved to
+// are seeded from the rates file at ratesPath, the memory store always loads it.
+// The returned close func releases the backend.
+func OpenRateStore(kind, path, ratesPath string) (*MemoryRateStore, func() error, error) {
+	var backend RateBackend
+	var err error
+	switch kind {
+	case "", StoreMemory:
+		store, err := RateStoreFromFile(ratesPath)
+		return store, func() error { return nil }, err
+	case StoreFile:
+		backend = NewFileRateBackend(path)
+	case StoreBolt:
+		backend, err = OpenBoltRateBackend(path)
+	case StoreSQLite:
+		backend, err = OpenSQLRateBackend("sqlite", path)
+	default:
+		err = fmt.Errorf("unknown rate store %q, expected one of: memory, file, bolt, sqlite", kind)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	store, err := NewBackedRateStore(backend)
+	if err == nil && store.Version() == 0 {
+		var seed *MemoryRateStore
+		seed, err = RateStoreFromFile(ratesPath)
+		if err == nil {
+			set, _ := seed.Snapshot()
+			_, err = store.Set(set, 0)
+		}
+	}
+	if err != nil {
+		backend.Close()
+		return nil, nil, err
+	}
+	return store, backend.Close, nil
+}
+
+// Keeps the rate set in a json file, for a single instance
+type FileRateBackend struct {
+	path string
+}
+
+func NewFileRateBackend(path string) *FileRateBackend {
+	return &FileRateBackend{path: path}
+}
+
+func (b *FileRateBackend) Load() (Rates, int, error) {
+	file, err := ioutil.ReadFile(b.path)
+	if os.IsNotExist(err) {
+		return Rates{}, 0, nil
+	}
+	if err != nil {
+		return Rates{}, 0, err
+	}
+	var stored storedRates
+	err = json.Unmarshal(file, &stored)
+	return stored.Rates, stored.Version, err
+}
+
+func (b *FileRateBackend) Save(set Rates, version int) error {
+	out, err := json.MarshalIndent(storedRates{Version: version, Rates: set}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(b.path, out)
+}
+
+func (b *FileRateBackend) Close() error {
+	return nil
+}
+
+var (
+	boltBucket = []byte("rates")
+	boltKey    = []byte("set")
+)
+
+// Keeps the rate set in an embedded bbolt database
+type BoltRateBackend struct {
+	db *bolt.DB
+}
+
+func OpenBoltRateBackend(path string) (*BoltRateBackend, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltRateBackend{db: db}, nil
+}
+
+func (b *BoltRateBackend) Load() (Rates, int, error) {
+	var stored storedRates
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return getStoredRates(tx, &stored)
+	})
+	return stored.Rates, stored.Version, err
+}
+
+func (b *BoltRateBackend) Save(set Rates, version int) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		var stored storedRates
+		err := getStoredRates(tx, &stored)
+		if err != nil {
+			return err
+		}
+		if stored.Version != version-1 {
+			return errVersionMismatch
+		}
+		out, err := json.Marshal(storedRates{Version: version, Rates: set})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(boltBucket).Put(boltKey, out)
+	})
+}
+
+func (b *BoltRateBackend) Close() error {
+	return b.db.Close()
+}
+
+func getStoredRates(tx *bolt.Tx, stored *storedRates) error {
+	value := tx.Bucket(boltBucket).Get(boltKey)
+	if value == nil {
+		return nil
+	}
+	return json.Unmarshal(value, stored)
+}
+
+// Keeps the rate set in a sql database, one row per rate plus a row for the set level settings.
+// Queries use ? placeholders and portable types, tested against SQLite.
+type SQLRateBackend struct {
+	db *sql.DB
+}
+
+const sqlRateSchema = `
+CREATE TABLE IF NOT EXISTS rate_set (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	version INTEGER NOT NULL,
+	policy TEXT NOT NULL,
+	charges TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS rates (
+	id TEXT PRIMARY KEY,
+	position INTEGER NOT NULL,
+	body TEXT NOT NULL
+);`
+
+func OpenSQLRateBackend(driver, dsn string) (*SQLRateBackend, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.Exec(sqlRateSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLRateBackend{db: db}, nil
+}
+
+func (b *SQLRateBackend) Load() (Rates, int, error) {
+	var set Rates
+	var version int
+	var charges string
+	err := b.db.QueryRow(`SELECT version, policy, charges FROM rate_set WHERE id = 1`).Scan(&version, &set.Policy, &charges)
+	if err == sql.ErrNoRows {
+		return set, 0, nil
+	}
+	if err != nil {
+		return set, 0, err
+	}
+	err = json.Unmarshal([]byte(charges), &set.Charges)
+	if err != nil {
+		return set, 0, err
+	}
+
+	rows, err := b.db.Query(`SELECT body FROM rates ORDER BY position`)
+	if err != nil {
+		return set, 0, err
+	}
+	defer rows.Close()
+	set.Rates = []Rate{}
+	for rows.Next() {
+		var body string
+		var rate Rate
+		err = rows.Scan(&body)
+		if err == nil {
+			err = json.Unmarshal([]byte(body), &rate)
+		}
+		if err != nil {
+			return set, 0, err
+		}
+		set.Rates = append(set.Rates, rate)
+	}
+	return set, version, rows.Err()
+}
+
+func (b *SQLRateBackend) Save(set Rates, version int) error {
+	charges, err := json.Marshal(set.Charges)
+	if err != nil {
+		return err
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var result sql.Result
+	if version == 1 {
+		result, err = tx.Exec(`INSERT INTO rate_set (id, version, policy, charges) SELECT 1, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM rate_set)`, version, set.Policy, string(charges))
+	} else {
+		result, err = tx.Exec(`UPDATE rate_set SET version = ?, policy = ?, charges = ? WHERE id = 1 AND version = ?`, version, set.Policy, string(charges), version-1)
+	}
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated != 1 {
+		return errVersionMismatch
+	}
+
+	_, err = tx.Exec(`DELETE FROM rates`)
+	if err != nil {
+		return err
+	}
+	for i, v := range set.Rates {
+		body, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO rates (id, position, body) VALUES (?, ?, ?)`, v.ID, i, string(body))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (b *SQLRateBackend) Close() error {
+	return b.db.Close()
+}
+
+// writes data to a temp file next to path then renames it over path,
+// so a crash never leaves a half written file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
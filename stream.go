@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateStore that audits each successful change and then calls every listener. Changes are made
+// one at a time so the audit log and the listeners see them in version order, listeners must not block.
+type notifyingRateStore struct {
+	RateStore
+	mu        sync.Mutex
+	audit     *AuditLog
+	listeners []func(RateSetChange)
+}
+
+// Returns the store with its changes recorded as made by actor
+func (store *notifyingRateStore) As(actor auditActor) RateStore {
+	return &attributedRateStore{notifyingRateStore: store, actor: actor}
+}
+
+// Applies a change, appends it to the audit log and notifies the listeners before the next change can
+// start. The change stays applied when the append fails, the error is returned so the caller can fail
+// the request.
+func (store *notifyingRateStore) commit(actor auditActor, apply func() (RateSetChange, error)) (RateSetChange, error) {
+	store.mu.Lock()
+	change, err := apply()
+	if err == nil {
+		err = store.audit.Record(actor, change)
+	}
+	if err == nil || errors.Is(err, errAuditWrite) {
+		store.notify(change)
+	}
+	store.mu.Unlock()
+	return change, err
+}
+
+func (store *notifyingRateStore) notify(change RateSetChange) {
+	for _, listener := range store.listeners {
+		listener(change)
+	}
+}
+
+func (store *notifyingRateStore) Set(set Rates, ifVersion int) (RateSetChange, error) {
+	return store.As(auditActor{Actor: anonymousPrincipal}).Set(set, ifVersion)
+}
+
+func (store *notifyingRateStore) Add(rate Rate, ifVersion int) (Rate, RateSetChange, error) {
+	return store.As(auditActor{Actor: anonymousPrincipal}).Add(rate, ifVersion)
+}
+
+func (store *notifyingRateStore) Update(id string, ifVersion int, update func(*Rate) error) (Rate, RateSetChange, error) {
+	return store.As(auditActor{Actor: anonymousPrincipal}).Update(id, ifVersion, update)
+}
+
+func (store *notifyingRateStore) Delete(id string, ifVersion int) (RateSetChange, error) {
+	return store.As(auditActor{Actor: anonymousPrincipal}).Delete(id, ifVersion)
+}
+
+// The writes of a notifyingRateStore attributed to one actor
+type attributedRateStore struct {
+	*notifyingRateStore
+	actor auditActor
+}
+
+func (store *attributedRateStore) Set(set Rates, ifVersion int) (RateSetChange, error) {
+	return store.commit(store.actor, func() (RateSetChange, error) {
+		return store.RateStore.Set(set, ifVersion)
+	})
+}
+
+func (store *attributedRateStore) Add(rate Rate, ifVersion int) (Rate, RateSetChange, error) {
+	var added Rate
+	change, err := store.commit(store.actor, func() (RateSetChange, error) {
+		var change RateSetChange
+		var err error
+		added, change, err = store.RateStore.Add(rate, ifVersion)
+		return change, err
+	})
+	return added, change, err
+}
+
+func (store *attributedRateStore) Update(id string, ifVersion int, update func(*Rate) error) (Rate, RateSetChange, error) {
+	var updated Rate
+	change, err := store.commit(store.actor, func() (RateSetChange, error) {
+		var change RateSetChange
+		var err error
+		updated, change, err = store.RateStore.Update(id, ifVersion, update)
+		return change, err
+	})
+	return updated, change, err
+}
+
+func (store *attributedRateStore) Delete(id string, ifVersion int) (RateSetChange, error) {
+	return store.commit(store.actor, func() (RateSetChange, error) {
+		return store.RateStore.Delete(id, ifVersion)
+	})
+}
+
+// number of recent changes kept so reconnecting clients can resume with diffs
+const broadcastHistory = 100
+
+// Fans rate set changes out to stream subscribers and remembers the most recent ones
+type RateBroadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan RateSetChange]struct{}
+	history     []RateSetChange
+}
+
+func NewRateBroadcaster() *RateBroadcaster {
+	return &RateBroadcaster{subscribers: map[chan RateSetChange]struct{}{}}
+}
+
+// Returns a channel of changes and a func to unsubscribe. Subscribers that fall too far
+// behind have their channel closed, they can reconnect and resume from their last version.
+func (b *RateBroadcaster) Subscribe() (<-chan RateSetChange, func()) {
+	ch := make(chan RateSetChange, 16)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (b *RateBroadcaster) Publish(change RateSetChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.history = append(b.history, change)
+	if len(b.history) > broadcastHistory {
+		b.history = b.history[len(b.history)-broadcastHistory:]
+	}
+	for ch := range b.subscribers {
+		select {
+		case ch <- change:
+		default:
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Returns the changes after version up to current, false when they are no longer all remembered
+func (b *RateBroadcaster) Since(version, current int) ([]RateSetChange, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []RateSetChange
+	next := version
+	for _, v := range b.history {
+		if v.Version <= version || v.Version > current {
+			continue
+		}
+		if v.PreviousVersion != next {
+			return nil, false
+		}
+		out = append(out, v)
+		next = v.Version
+	}
+	return out, next == current
+}
+
+// SSE event names
+const (
+	StreamEventRates = "rates"
+	StreamEventDiff  = "diff"
+)
+
+type RateStreamController struct {
+	Handler
+	Rates       RateStore
+	Broadcaster *RateBroadcaster
+	Heartbeat   time.Duration
+}
+
+func NewRateStreamController(store RateStore, broadcaster *RateBroadcaster) *RateStreamController {
+	controller := RateStreamController{
+		Handler:     Handler{},
+		Rates:       store,
+		Broadcaster: broadcaster,
+		Heartbeat:   15 * time.Second,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetStream)
+	return &controller
+}
+
+// GetStream - Streams rate set updates as server-sent events.
+// @Summary Streams rate set updates as server-sent events.
+// @Description Sends the current rates as a "rates" event then one event per change, each with the rate set version as its id.
+// @Description With mode=diff changes are sent as "diff" events holding the RateSetChange instead of the whole set.
+// @Description Reconnecting clients send Last-Event-ID and get the diffs they missed, or the whole set when those are no longer known.
+// @Description Heartbeat comments keep idle connections open.
+// @Tags rates
+// @Produce text/event-stream
+// @Param mode query string false "rates (default) or diff"
+// @Param Last-Event-ID header string false "Last rate set version received"
+// @Success 200 ""
+// @Failure 400 {object} Problem
+// @Failure 500 {object} Problem
+// @Router /rates/stream [get]
+func (c *RateStreamController) GetStream(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != StreamEventRates && mode != StreamEventDiff {
+		webError(w, r, ErrBadQuery, "")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		webError(w, r, ErrInternal, "")
+		return
+	}
+
+	// subscribe before reading the current version so no change falls in between
+	changes, unsubscribe := c.Broadcaster.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sent := -1
+	if lastID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		sent = lastID
+	}
+	current := c.Rates.Version()
+	if sent != current {
+		missed, ok := c.Broadcaster.Since(sent, current)
+		if mode == StreamEventDiff && ok {
+			for _, v := range missed {
+				writeEvent(w, v.Version, StreamEventDiff, v)
+			}
+			sent = current
+		} else {
+			sent = c.writeRates(w, sent)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(c.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case change, open := <-changes:
+			if !open {
+				return
+			}
+			if mode == StreamEventDiff && change.Version > sent {
+				writeEvent(w, change.Version, StreamEventDiff, change)
+				sent = change.Version
+			} else if mode != StreamEventDiff || c.Rates.Version() < sent {
+				// a store that went back to an older version is resent whole, diffs wouldn't apply
+				sent = c.writeRates(w, sent)
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writes the current rate set as an event unless its version is the one last sent, returns the version
+func (c *RateStreamController) writeRates(w http.ResponseWriter, sent int) int {
+	set, version := c.Rates.Snapshot()
+	if version != sent {
+		writeEvent(w, version, StreamEventRates, set)
+	}
+	return version
+}
+
+func writeEvent(w http.ResponseWriter, id int, event string, data interface{}) {
+	out, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, out)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+Example Surge, prices of surge enabled rates go up 25% while the garage is 90% full:
+
+	{
+		"factor": 1.25,
+		"occupancy": 90,
+		"source": "gate-counter"
+	}
+
+The factor is worked out by whatever tracks occupancy or demand, the api only applies it.
+Occupancy and Source are informational. A factor of 1 turns surge pricing off, rates with surge
+bounds are still kept within them.
+*/
+type Surge struct {
+	Factor    float64   `json:"factor"`
+	Occupancy *float64  `json:"occupancy,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+/*
+Example SurgeBounds, a rate that surges but never below $5.00 or above $30.00:
+
+	"surge": {"floor": 500, "ceiling": 3000}
+
+Only rates with surge bounds are surge priced, a ceiling of 0 leaves the surged price uncapped.
+*/
+type SurgeBounds struct {
+	Floor   int `json:"floor,omitempty"`
+	Ceiling int `json:"ceiling,omitempty"`
+}
+
+// upper bound on the factor so a bad feed can't multiply prices without limit
+const maxSurgeFactor = 10
+
+func (s Surge) Validate() error {
+	if s.Factor <= 0 || s.Factor > maxSurgeFactor {
+		return errors.New("'factor' must be greater than 0 and at most 10")
+	}
+	if s.Occupancy != nil && (*s.Occupancy < 0 || *s.Occupancy > 100) {
+		return errors.New("'occupancy' must be 0-100")
+	}
+	return nil
+}
+
+func (b *SurgeBounds) Validate() error {
+	if b.Floor < 0 || b.Ceiling < 0 {
+		return errors.New("'surge' prices must not be negative")
+	}
+	if b.Ceiling > 0 && b.Floor > b.Ceiling {
+		return errors.New("'surge.floor' must not be above 'surge.ceiling'")
+	}
+	return nil
+}
+
+// Returns price multiplied by factor and kept within the bounds
+func (b *SurgeBounds) PriceFor(price int, factor float64) int {
+	surged := int(math.Round(float64(price) * factor))
+	if surged < b.Floor {
+		surged = b.Floor
+	}
+	if b.Ceiling > 0 && surged > b.Ceiling {
+		surged = b.Ceiling
+	}
+	return surged
+}
+
+// Holds the current surge factor, safe for concurrent use
+type SurgeStore struct {
+	mu    sync.RWMutex
+	surge Surge
+}
+
+func NewSurgeStore() *SurgeStore {
+	return &SurgeStore{surge: Surge{Factor: 1}}
+}
+
+func (store *SurgeStore) Get() Surge {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	return store.surge
+}
+
+func (store *SurgeStore) Set(surge Surge) (Surge, error) {
+	err := surge.Validate()
+	if err != nil {
+		return surge, err
+	}
+	if surge.UpdatedAt.IsZero() {
+		surge.UpdatedAt = time.Now().UTC()
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.surge = surge
+	return surge, nil
+}
+
+// Surges the price of an available quote when its winning rate has surge bounds, nil safe.
+// The bounds apply whatever the factor, a nil store or a factor of 1 only clamps the price.
+// Applied before promos so discounts come off the surged price.
+func (store *SurgeStore) Apply(quote *Quote, rates []Rate) {
+	if !quote.Available {
+		return
+	}
+	i := indexOfRate(rates, quote.RateID)
+	if i < 0 || rates[i].Surge == nil {
+		return
+	}
+	factor := 1.0
+	if store != nil {
+		factor = store.Get().Factor
+	}
+	adjustment := rates[i].Surge.PriceFor(quote.Price, factor) - quote.Price
+	if factor == 1 && adjustment == 0 {
+		return
+	}
+	quote.SurgeFactor = factor
+	quote.SurgeAdjustment = adjustment
+	quote.Price += adjustment
+}
+
+// Loads the surge factor from a json file
+func (store *SurgeStore) Load(path string) error {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var surge Surge
+	err = json.Unmarshal(file, &surge)
+	if err != nil {
+		return err
+	}
+	if surge.UpdatedAt.IsZero() {
+		if info, err := os.Stat(path); err == nil {
+			surge.UpdatedAt = info.ModTime().UTC()
+		}
+	}
+	_, err = store.Set(surge)
+	return err
+}
+
+// Reloads the surge file whenever its modification time changes until stop is closed.
+// Bad files are logged and the previous factor is kept.
+func (store *SurgeStore) Watch(path string, interval time.Duration, stop <-chan struct{}) {
+	var modified time.Time
+	if info, err := os.Stat(path); err == nil {
+		modified = info.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modified) {
+				continue
+			}
+			modified = info.ModTime()
+			err = store.Load(path)
+			if err != nil {
+				log.Printf("surge: reloading %s: %v", path, err)
+			}
+		}
+	}
+}
+
+type SurgeController struct {
+	Handler
+	Surge *SurgeStore
+}
+
+func NewSurgeController(store *SurgeStore) *SurgeController {
+	controller := SurgeController{
+		Handler: Handler{},
+		Surge:   store,
+	}
+	controller.Handler[http.MethodGet] = http.HandlerFunc(controller.GetSurge)
+	controller.Handler[http.MethodPut] = http.HandlerFunc(controller.PutSurge)
+	return &controller
+}
+
+// GetSurge - Returns the current surge factor.
+// @Summary Returns the current surge factor.
+// @Description Returns the factor applied to the price of surge enabled rates.
+// @Tags surge
+// @Produce json
+// @Success 200 {object} Surge
+// @Router /surge [get]
+func (c *SurgeController) GetSurge(w http.ResponseWriter, r *http.Request) {
+	writeSurge(w, c.Surge.Get())
+}
+
+// PutSurge - Sets the surge factor.
+// @Summary Sets the surge factor.
+// @Description Sets the factor applied to the price of surge enabled rates, typically fed from occupancy or demand.
+// @Tags surge
+// @Accept json
+// @Produce json
+// @Param Surge body Surge true "Surge"
+// @Success 200 {object} Surge
+// @Failure 400 {object} Problem
+// @Failure 422 {object} Problem
+// @Failure 401 {object} Problem
+// @Router /surge [put]
+func (c *SurgeController) PutSurge(w http.ResponseWriter, r *http.Request) {
+	var surge Surge
+	if r.Body == nil {
+		webError(w, r, ErrMissingBody, "")
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&surge)
+	if err != nil {
+		webError(w, r, ErrBadBody, err.Error())
+		return
+	}
+	// the api stamps updates itself
+	surge.UpdatedAt = time.Time{}
+	surge, err = c.Surge.Set(surge)
+	if err != nil {
+		webError(w, r, ErrInvalidSurge, err.Error())
+		return
+	}
+	writeSurge(w, surge)
+}
+
+func writeSurge(w http.ResponseWriter, surge Surge) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(surge)
+}
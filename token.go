@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// What a quote token vouches for, checkout services can honour Price / Total without re-pricing
+type QuoteClaims struct {
+	StartDate ISO8601Time `json:"startDate"`
+	EndDate   ISO8601Time `json:"endDate"`
+	RateID    string      `json:"rateId,omitempty"`
+	RateClass
+	PromoCode string    `json:"promoCode,omitempty"`
+	Price     int       `json:"price"`
+	Total     int       `json:"total"`
+	Version   int       `json:"version"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Reasons a quote token is rejected
+const (
+	TokenMalformed = "malformed"
+	TokenBadSig    = "invalid-signature"
+	TokenExpired   = "expired"
+)
+
+// how long quote tokens stay valid unless RATE_API_QUOTE_TTL says otherwise
+const defaultQuoteTTL = 15 * time.Minute
+
+var errTokenUnavailable = errors.New("only available quotes can be signed")
+
+/*
+Signs and verifies quote tokens. A token is the base64url json claims and the base64url
+HMAC-SHA256 of them joined by a dot:
+
+	eyJzdGFydERhdGUiOiIyMDE1LTA3LTAx...fQ.3q2-7w...
+
+Every instance that verifies tokens must share the key.
+*/
+type QuoteSigner struct {
+	key []byte
+	ttl time.Duration
+}
+
+func NewQuoteSigner(key []byte, ttl time.Duration) *QuoteSigner {
+	return &QuoteSigner{
+		key: key,
+		ttl: ttl,
+	}
+}
+
+// A signer with a random key, its tokens can only be verified by this process
+func NewEphemeralQuoteSigner(ttl time.Duration) *QuoteSigner {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		panic(err)
+	}
+	return NewQuoteSigner(key, ttl)
+}
+
+func (s *QuoteSigner) Sign(quote Quote, now time.Time) (string, error) {
+	if !quote.Available {
+		return "", errTokenUnavailable
+	}
+	claims := QuoteClaims{
+		StartDate: quote.StartDate,
+		EndDate:   quote.EndDate,
+		RateID:    quote.RateID,
+		RateClass: quote.RateClass,
+		PromoCode: quote.PromoCode,
+		Price:     quote.Price,
+		Total:     quote.Total,
+		Version:   quote.Version,
+		IssuedAt:  now.UTC().Truncate(time.Second),
+		ExpiresAt: now.UTC().Add(s.ttl).Truncate(time.Second),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// Checks a token's signature and expiry, returns one of the Token reasons when it is rejected
+func (s *QuoteSigner) Verify(token string, now time.Time) (QuoteClaims, string) {
+	var claims QuoteClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return claims, TokenMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, TokenMalformed
+	}
+	if !hmac.Equal(sig, s.mac(parts[0])) {
+		return claims, TokenBadSig
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err == nil {
+		err = json.Unmarshal(payload, &claims)
+	}
+	if err != nil {
+		return claims, TokenMalformed
+	}
+	if !now.Before(claims.ExpiresAt) {
+		return claims, TokenExpired
+	}
+	return claims, ""
+}
+
+func (s *QuoteSigner) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// /rate response when a token is requested
+type SignedRate struct {
+	Price int    `json:"price"`
+	Token string `json:"token"`
+}
+
+type TokenVerifyRequest struct {
+	Token string `json:"token"`
+}
+
+// Result of checking a quote token, Claims is only set on valid tokens.
+// CurrentVersion lets a checkout tell whether rates changed since the quote, the token stays valid either way.
+type TokenVerification struct {
+	Valid          bool         `json:"valid"`
+	Reason         string       `json:"reason,omitempty"`
+	Claims         *QuoteClaims `json:"claims,omitempty"`
+	CurrentVersion int          `json:"currentVersion"`
+}
+
+type QuoteVerifyController struct {
+	Handler
+	Signer *QuoteSigner
+	Rates  RateStore
+}
+
+func NewQuoteVerifyController(signer *QuoteSigner, rates RateStore) *QuoteVerifyController {
+	controller := QuoteVerifyController{
+		Handler: Handler{},
+		Signer:  signer,
+		Rates:   rates,
+	}
+	controller.Handler[http.MethodPost] = http.HandlerFunc(controller.PostVerify)
+	return &controller
+}
+
+// PostVerify - Checks a signed quote token.
+// @Summary Checks a signed quote token.
+// @Description Checks the signature and expiry of a token from /rate or /quote with token=true.
+// @Description Rejected tokens are still a 200 with valid false and the reason.
+// @Tags rates
+// @Accept json
+// @Produce json
+// @Param TokenVerifyRequest body TokenVerifyRequest true "Token"
+// @Success 200 {object} TokenVerification
+// @Failure 400 {object} Problem
+// @Router /quote/verify [post]
+func (c *QuoteVerifyController) PostVerify(w http.ResponseWriter, r *http.Request) {
+	var req TokenVerifyRequest
+	if r.Body == nil {
+		webError(w, r, ErrMissingBody, "")
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil || req.Token == "" {
+		webError(w, r, ErrBadBody, "")
+		return
+	}
+
+	out := TokenVerification{CurrentVersion: c.Rates.Version()}
+	claims, reason := c.Signer.Verify(req.Token, time.Now())
+	out.Valid = reason == ""
+	out.Reason = reason
+	if out.Valid {
+		out.Claims = &claims
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// reports whether the client asked for a signed quote token with ?token=true
+func wantsToken(r *http.Request) bool {
+	return r.URL.Query().Get("token") == "true"
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The subset of OpenAPI 3 schema objects used by docs/openapi.json
+type apiSchema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Required             []string              `json:"required"`
+	Properties           map[string]*apiSchema `json:"properties"`
+	AdditionalProperties interface{}           `json:"additionalProperties"`
+	Items                *apiSchema            `json:"items"`
+	OneOf                []*apiSchema          `json:"oneOf"`
+	Enum                 []interface{}         `json:"enum"`
+	Minimum              *float64              `json:"minimum"`
+	Maximum              *float64              `json:"maximum"`
+	ExclusiveMinimum     bool                  `json:"exclusiveMinimum"`
+	ReadOnly             bool                  `json:"readOnly"`
+}
+
+type apiParameter struct {
+	Name     string     `json:"name"`
+	In       string     `json:"in"`
+	Required bool       `json:"required"`
+	Schema   *apiSchema `json:"schema"`
+}
+
+type apiOperation struct {
+	Parameters  []apiParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool `json:"required"`
+		Content  map[string]struct {
+			Schema *apiSchema `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+}
+
+type apiSpec struct {
+	Paths      map[string]map[string]*apiOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]*apiSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+// A request field that doesn't match the api schema, Pointer is a JSON pointer into the body
+// or the name of the query parameter
+type FieldError struct {
+	Pointer string `json:"pointer"`
+	Detail  string `json:"detail"`
+}
+
+// Largest request body read, anything longer is answered with 413
+const maxRequestBody = 1 << 20
+
+// Pairs of fields where the second may not be before the first
+var spanFields = [][2]string{{"validFrom", "validUntil"}}
+
+// Validates request bodies and query parameters against the operations in spec.
+// Unparseable bodies and bad query parameters are rejected with 400, bodies that parse but break the schema
+// (unknown or missing fields, wrong types, a promo ending before it starts) with 422 and bodies over maxRequestBody with 413.
+// Unknown query parameters are ignored on GET so cache busters keep working. Paths or methods the spec doesn't
+// describe are passed through for the router to answer.
+func NewValidationMiddleware(spec []byte) (func(http.Handler) http.Handler, error) {
+	var doc apiSpec
+	err := json.Unmarshal(spec, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+			}
+			op := doc.operation(r.Method, r.URL.Path)
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			errs := doc.validateQuery(op, r)
+			if len(errs) > 0 {
+				writeProblem(w, r, ErrBadQuery, "", errs)
+				return
+			}
+
+			if op.RequestBody == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var bod []byte
+			if r.Body != nil {
+				bod, err = ioutil.ReadAll(r.Body)
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					webError(w, r, ErrBodyTooLarge, fmt.Sprintf("bodies are limited to %d bytes", maxRequestBody))
+					return
+				}
+				if err != nil {
+					webError(w, r, ErrBadBody, err.Error())
+					return
+				}
+			}
+			if len(bytes.TrimSpace(bod)) == 0 {
+				if op.RequestBody.Required {
+					webError(w, r, ErrMissingBody, "")
+					return
+				}
+			} else {
+				var value interface{}
+				decoder := json.NewDecoder(bytes.NewReader(bod))
+				decoder.UseNumber()
+				err = decoder.Decode(&value)
+				if err != nil {
+					webError(w, r, ErrBadBody, err.Error())
+					return
+				}
+				errs = doc.validate(op.RequestBody.Content["application/json"].Schema, value, "")
+				if len(errs) > 0 {
+					writeProblem(w, r, ErrInvalidBody, "", errs)
+					return
+				}
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(bod))
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// Finds the operation for a request path, literal segments win over {parameters}
+func (doc *apiSpec) operation(method, path string) *apiOperation {
+	segments := strings.Split(path, "/")
+	var best *apiOperation
+	bestLiterals := -1
+	for template, operations := range doc.Paths {
+		op, ok := operations[strings.ToLower(method)]
+		if !ok {
+			continue
+		}
+		parts := strings.Split(template, "/")
+		if len(parts) != len(segments) {
+			continue
+		}
+		literals := 0
+		for i, v := range parts {
+			if strings.HasPrefix(v, "{") {
+				if segments[i] == "" {
+					literals = -1
+					break
+				}
+				continue
+			}
+			if v != segments[i] {
+				literals = -1
+				break
+			}
+			literals++
+		}
+		if literals > bestLiterals {
+			best, bestLiterals = op, literals
+		}
+	}
+	return best
+}
+
+func (doc *apiSpec) validateQuery(op *apiOperation, r *http.Request) []FieldError {
+	var errs []FieldError
+	query := r.URL.Query()
+	known := map[string]bool{}
+	for _, v := range op.Parameters {
+		if v.In != "query" {
+			continue
+		}
+		known[v.Name] = true
+		raw, present := query[v.Name]
+		if !present {
+			if v.Required {
+				errs = append(errs, FieldError{v.Name, "is required"})
+			}
+			continue
+		}
+		value, err := queryValue(doc.resolve(v.Schema), raw[0])
+		if err != nil {
+			errs = append(errs, FieldError{v.Name, err.Error()})
+			continue
+		}
+		for _, e := range doc.validate(v.Schema, value, "") {
+			errs = append(errs, FieldError{v.Name, e.Detail})
+		}
+	}
+	if r.Method == http.MethodGet {
+		return errs
+	}
+	var unknown []string
+	for k := range query {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+	for _, k := range unknown {
+		errs = append(errs, FieldError{k, "is not a known parameter"})
+	}
+	return errs
+}
+
+// converts a query parameter to the json value its schema describes
+func queryValue(schema *apiSchema, raw string) (interface{}, error) {
+	switch schema.Type {
+	case "integer", "number":
+		_, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a %s", schema.Type)
+		}
+		return json.Number(raw), nil
+	case "boolean":
+		out, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return out, nil
+	default:
+		return raw, nil
+	}
+}
+
+func (doc *apiSpec) resolve(schema *apiSchema) *apiSchema {
+	for schema != nil && schema.Ref != "" {
+		schema = doc.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	return schema
+}
+
+// Checks value, decoded with UseNumber, against schema, pointer is where value sits in the body
+func (doc *apiSpec) validate(schema *apiSchema, value interface{}, pointer string) []FieldError {
+	schema = doc.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+	field := pointer
+	if field == "" {
+		field = "/"
+	}
+
+	if len(schema.OneOf) > 0 {
+		// report the closest alternative when none match
+		var closest []FieldError
+		for i, v := range schema.OneOf {
+			errs := doc.validate(v, value, pointer)
+			if len(errs) == 0 {
+				return nil
+			}
+			if i == 0 || len(errs) < len(closest) {
+				closest = errs
+			}
+		}
+		return closest
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []FieldError{{field, "must be an object"}}
+		}
+		return doc.validateObject(schema, object, pointer)
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return []FieldError{{field, "must be an array"}}
+		}
+		var errs []FieldError
+		for i, v := range array {
+			errs = append(errs, doc.validate(schema.Items, v, pointer+"/"+strconv.Itoa(i))...)
+		}
+		return errs
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []FieldError{{field, "must be a string"}}
+		}
+		if !enumContains(schema.Enum, s) {
+			return []FieldError{{field, "must be one of " + enumList(schema.Enum)}}
+		}
+		switch schema.Format {
+		case "date-time":
+			_, err := time.Parse(ISO8601, s)
+			if err != nil {
+				return []FieldError{{field, "must be a time like " + ISO8601}}
+			}
+		case "date":
+			_, err := time.Parse("2006-01-02", s)
+			if err != nil {
+				return []FieldError{{field, "must be a date like 2006-01-02"}}
+			}
+		}
+	case "integer", "number":
+		n, ok := value.(json.Number)
+		if !ok {
+			return []FieldError{{field, "must be a " + schema.Type}}
+		}
+		f, err := n.Float64()
+		if err != nil || (schema.Type == "integer" && f != math.Trunc(f)) {
+			return []FieldError{{field, "must be a " + schema.Type}}
+		}
+		if schema.Minimum != nil && (f < *schema.Minimum || (schema.ExclusiveMinimum && f == *schema.Minimum)) {
+			if schema.ExclusiveMinimum {
+				return []FieldError{{field, "must be greater than " + formatBound(*schema.Minimum)}}
+			}
+			return []FieldError{{field, "must be at least " + formatBound(*schema.Minimum)}}
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			return []FieldError{{field, "must be at most " + formatBound(*schema.Maximum)}}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []FieldError{{field, "must be true or false"}}
+		}
+	}
+	return nil
+}
+
+func (doc *apiSpec) validateObject(schema *apiSchema, object map[string]interface{}, pointer string) []FieldError {
+	var errs []FieldError
+	for _, k := range schema.Required {
+		if v, ok := object[k]; !ok || v == nil {
+			errs = append(errs, FieldError{pointer + "/" + k, "is required"})
+		}
+	}
+
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		property, known := schema.Properties[k]
+		switch {
+		case known && property.ReadOnly:
+			continue
+		case known:
+			// null leaves optional fields unset, missing required ones are reported above
+			if object[k] != nil {
+				errs = append(errs, doc.validate(property, object[k], pointer+"/"+k)...)
+			}
+		case schema.AdditionalProperties == false:
+			errs = append(errs, FieldError{pointer + "/" + k, "is not a known field"})
+		}
+	}
+
+	for _, v := range spanFields {
+		start, startOK := object[v[0]].(string)
+		end, endOK := object[v[1]].(string)
+		if !startOK || !endOK {
+			continue
+		}
+		startTime, startErr := time.Parse(ISO8601, start)
+		endTime, endErr := time.Parse(ISO8601, end)
+		if startErr == nil && endErr == nil && endTime.Before(startTime) {
+			errs = append(errs, FieldError{pointer + "/" + v[1], "must not be before " + v[0]})
+		}
+	}
+	return errs
+}
+
+func enumContains(enum []interface{}, s string) bool {
+	if len(enum) == 0 {
+		return true
+	}
+	for _, v := range enum {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func enumList(enum []interface{}) string {
+	out := make([]string, len(enum))
+	for i, v := range enum {
+		out[i] = fmt.Sprint(v)
+	}
+	return strings.Join(out, ", ")
+}
+
+func formatBound(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+/*
+Example webhooks file, every subscriber gets every rate set update:
+
+	{
+		"webhooks": [
+			{"url": "https://search.example.com/hooks/rates", "secret": "s3cret"}
+		]
+	}
+
+Each delivery is signed with the subscriber's secret, the X-Rate-API-Signature header holds
+"sha256=" and the hex HMAC-SHA256 of the raw body.
+*/
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+type Webhooks struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// Body of a webhook delivery
+type WebhookEvent struct {
+	ID              string    `json:"id"`
+	Type            string    `json:"type"`
+	Timestamp       time.Time `json:"timestamp"`
+	PreviousVersion int       `json:"previousVersion"`
+	Version         int       `json:"version"`
+	Diff            RateDiff  `json:"diff"`
+}
+
+const WebhookRatesUpdated = "rates.updated"
+
+// A delivery that used up every attempt, appended to the dead letter file as a JSONL line
+type DeadLetter struct {
+	URL      string       `json:"url"`
+	Event    WebhookEvent `json:"event"`
+	Attempts int          `json:"attempts"`
+	Error    string       `json:"error"`
+	FailedAt time.Time    `json:"failedAt"`
+}
+
+func (h Webhook) Validate() error {
+	if h.URL == "" {
+		return errors.New("'url' is required")
+	}
+	if h.Secret == "" {
+		return errors.New("'secret' is required")
+	}
+	return nil
+}
+
+// Delivers rate change events to every webhook in the background.
+// Each subscriber has its own queue so a slow one never holds up the others, deliveries are
+// retried Attempts times with a doubling Backoff before going to the dead letter file.
+type WebhookNotifier struct {
+	Attempts int
+	Backoff  time.Duration
+
+	client         *http.Client
+	deadLetterPath string
+	deadLetterMu   sync.Mutex
+	hooks          []Webhook
+	queues         []chan WebhookEvent
+	wg             sync.WaitGroup
+}
+
+// size of each subscriber's queue, events beyond it go straight to the dead letter file
+const webhookQueueSize = 100
+
+func NewWebhookNotifier(webhooks []Webhook, deadLetterPath string) (*WebhookNotifier, error) {
+	n := &WebhookNotifier{
+		Attempts:       5,
+		Backoff:        time.Second,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		deadLetterPath: deadLetterPath,
+	}
+	for i, v := range webhooks {
+		err := v.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("webhook %d: %v", i, err)
+		}
+	}
+	for _, v := range webhooks {
+		queue := make(chan WebhookEvent, webhookQueueSize)
+		n.hooks = append(n.hooks, v)
+		n.queues = append(n.queues, queue)
+		n.wg.Add(1)
+		go n.deliverAll(v, queue)
+	}
+	return n, nil
+}
+
+func WebhookNotifierFromFile(path, deadLetterPath string) (*WebhookNotifier, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var webhooks Webhooks
+	err = json.Unmarshal(file, &webhooks)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebhookNotifier(webhooks.Webhooks, deadLetterPath)
+}
+
+// Queues change for every subscriber, nil safe
+func (n *WebhookNotifier) Notify(change RateSetChange) {
+	if n == nil {
+		return
+	}
+	event := WebhookEvent{
+		ID:              newRateID(),
+		Type:            WebhookRatesUpdated,
+		Timestamp:       time.Now().UTC(),
+		PreviousVersion: change.PreviousVersion,
+		Version:         change.Version,
+		Diff:            change.Diff,
+	}
+	for i, queue := range n.queues {
+		select {
+		case queue <- event:
+		default:
+			n.deadLetter(DeadLetter{URL: n.hooks[i].URL, Event: event, Error: "queue full"})
+		}
+	}
+}
+
+// Stops accepting events and waits for queued deliveries to finish
+func (n *WebhookNotifier) Close() {
+	if n == nil {
+		return
+	}
+	for _, queue := range n.queues {
+		close(queue)
+	}
+	n.wg.Wait()
+}
+
+func (n *WebhookNotifier) deliverAll(hook Webhook, queue <-chan WebhookEvent) {
+	defer n.wg.Done()
+	for event := range queue {
+		body, err := json.Marshal(event)
+		if err != nil {
+			log.Printf("webhook: encoding event %s: %v", event.ID, err)
+			continue
+		}
+
+		backoff := n.Backoff
+		for attempt := 1; ; attempt++ {
+			err = n.deliver(hook, event, body)
+			if err == nil {
+				break
+			}
+			if attempt >= n.Attempts {
+				n.deadLetter(DeadLetter{URL: hook.URL, Event: event, Attempts: attempt, Error: err.Error()})
+				break
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func (n *WebhookNotifier) deliver(hook Webhook, event WebhookEvent, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Rate-API-Event", event.Type)
+	request.Header.Set("X-Rate-API-Event-ID", event.ID)
+	request.Header.Set("X-Rate-API-Signature", WebhookSignature(hook.Secret, body))
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("subscriber answered %s", response.Status)
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) deadLetter(letter DeadLetter) {
+	letter.FailedAt = time.Now().UTC()
+	log.Printf("webhook: giving up on event %s for %s: %s", letter.Event.ID, letter.URL, letter.Error)
+	if n.deadLetterPath == "" {
+		return
+	}
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return
+	}
+
+	n.deadLetterMu.Lock()
+	defer n.deadLetterMu.Unlock()
+	file, err := os.OpenFile(n.deadLetterPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err == nil {
+		_, err = file.Write(append(line, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Printf("webhook: writing dead letter: %v", err)
+	}
+}
+
+// The X-Rate-API-Signature value for body, subscribers compare it against their own HMAC
+func WebhookSignature(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}